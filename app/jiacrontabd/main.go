@@ -9,6 +9,8 @@ import (
 	"jiacrontab/pkg/version"
 
 	"os"
+	// 内置时区数据,保证未安装tzdata的机器也能解析任务时区
+	_ "time/tzdata"
 
 	"github.com/iwannay/log"
 )
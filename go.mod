@@ -10,6 +10,7 @@ require (
 	github.com/iris-contrib/middleware/jwt v0.0.0-20200810001613-32cf668f999f
 	github.com/iwannay/log v0.0.0-20190630100042-7fa98f256ca1
 	github.com/kataras/iris/v12 v12.1.9-0.20200814111841-d0d7679a98f2
+	golang.org/x/sys v0.0.0-20200808120158-1030fc2bf1d9
 	gopkg.in/gomail.v2 v2.0.0-20160411212932-81ebce5c23df
 	gopkg.in/ini.v1 v1.58.0
 	gorm.io/driver/mysql v1.0.3
@@ -76,7 +77,6 @@ require (
 	github.com/yosssi/ace v0.0.5 // indirect
 	golang.org/x/crypto v0.0.0-20200728195943-123391ffb6de // indirect
 	golang.org/x/net v0.0.0-20200822124328-c89045814202 // indirect
-	golang.org/x/sys v0.0.0-20200808120158-1030fc2bf1d9 // indirect
 	golang.org/x/text v0.3.3 // indirect
 	golang.org/x/time v0.0.0-20200630173020-3af7569d3a1e // indirect
 	golang.org/x/xerrors v0.0.0-20200804184101-5ec99f83aff1 // indirect
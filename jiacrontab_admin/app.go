@@ -110,6 +110,16 @@ func newApp(adm *Admin) *iris.Application {
 		v2.Post("/crontab/job/edit", wrapHandler(EditJob))
 		v2.Post("/crontab/job/action", wrapHandler(ActionTask))
 		v2.Post("/crontab/job/exec", wrapHandler(ExecTask))
+		v2.Post("/crontab/job/run-once", wrapHandler(RunJobOnce))
+		v2.Post("/crontab/oneoff/list", wrapHandler(GetOneOffList))
+		v2.Post("/crontab/oneoff/cancel", wrapHandler(CancelOneOff))
+		v2.Post("/crontab/schedule/preview", wrapHandler(SchedulePreview))
+
+		v2.Post("/calendar/list", wrapHandler(GetCalendarList))
+		v2.Post("/calendar/get", wrapHandler(GetCalendar))
+		v2.Post("/calendar/edit", wrapHandler(EditCalendar))
+		v2.Post("/calendar/delete", wrapHandler(DeleteCalendar))
+		v2.Post("/calendar/import", wrapHandler(ImportCalendar))
 
 		v2.Post("/config/get", wrapHandler(GetConfig))
 		v2.Post("/config/mail/send", wrapHandler(SendTestMail))
@@ -0,0 +1,216 @@
+package admin
+
+import (
+	"errors"
+	"jiacrontab/models"
+	"jiacrontab/pkg/crontab"
+	"jiacrontab/pkg/proto"
+	"strings"
+)
+
+// GetCalendarList 获得排除日历列表
+func GetCalendarList(ctx *myctx) {
+	var (
+		err     error
+		list    []models.Calendar
+		count   int64
+		reqBody GetCalendarListReqParams
+		model   = models.DB().Model(&models.Calendar{})
+	)
+
+	if err = ctx.Valid(&reqBody); err != nil {
+		ctx.respParamError(err)
+		return
+	}
+
+	// 非超级管理员组只能看到本组和超级管理员组的日历
+	if !ctx.isSuper() {
+		model = model.Where("group_id in (?)", []uint{ctx.claims.GroupID, models.SuperGroup.ID})
+	}
+	if reqBody.SearchTxt != "" {
+		model = model.Where("name like ?", "%"+reqBody.SearchTxt+"%")
+	}
+
+	if err = model.Count(&count).Error; err != nil {
+		ctx.respDBError(err)
+		return
+	}
+
+	err = model.Order("updated_at desc").Offset((reqBody.Page - 1) * reqBody.Pagesize).Limit(reqBody.Pagesize).Find(&list).Error
+	if err != nil {
+		ctx.respDBError(err)
+		return
+	}
+
+	ctx.respSucc("", map[string]interface{}{
+		"list":     list,
+		"total":    count,
+		"page":     reqBody.Page,
+		"pagesize": reqBody.Pagesize,
+	})
+}
+
+// GetCalendar 获得排除日历
+func GetCalendar(ctx *myctx) {
+	var (
+		err      error
+		reqBody  GetCalendarReqParams
+		calendar models.Calendar
+	)
+
+	if err = ctx.Valid(&reqBody); err != nil {
+		ctx.respParamError(err)
+		return
+	}
+
+	if err = models.DB().Take(&calendar, "id=?", reqBody.CalendarID).Error; err != nil {
+		ctx.respDBError(err)
+		return
+	}
+
+	if !ctx.isSuper() && calendar.GroupID != ctx.claims.GroupID && calendar.GroupID != models.SuperGroup.ID {
+		ctx.respNotAllowed()
+		return
+	}
+
+	ctx.respSucc("", calendar)
+}
+
+// EditCalendar 新建或编辑排除日历
+// 仅超级管理员组和组管理员可以编辑本组的日历
+func EditCalendar(ctx *myctx) {
+	var (
+		err      error
+		reqBody  EditCalendarReqParams
+		calendar models.Calendar
+	)
+
+	if err = ctx.Valid(&reqBody); err != nil {
+		ctx.respParamError(err)
+		return
+	}
+
+	if reqBody.CalendarID != 0 {
+		if calendar, err = ctx.getEditableCalendar(reqBody.CalendarID); err != nil {
+			ctx.respNotAllowed()
+			return
+		}
+	} else if !ctx.isSuper() && !ctx.isRoot() {
+		ctx.respNotAllowed()
+		return
+	} else {
+		calendar.GroupID = ctx.claims.GroupID
+		calendar.CreatedUserID = ctx.claims.UserID
+		calendar.CreatedUsername = ctx.claims.Username
+	}
+
+	calendar.Name = reqBody.Name
+	calendar.Description = reqBody.Description
+	calendar.Excludes = reqBody.Excludes
+
+	if err = models.DB().Save(&calendar).Error; err != nil {
+		ctx.respDBError(err)
+		return
+	}
+
+	ctx.pubEvent(calendar.Name, event_EditCalendar, "", reqBody)
+	ctx.respSucc("", calendar)
+}
+
+// DeleteCalendar 删除排除日历,引用该日历的job在节点刷新缓存后不再排除其中的日期
+func DeleteCalendar(ctx *myctx) {
+	var (
+		err      error
+		reqBody  GetCalendarReqParams
+		calendar models.Calendar
+	)
+
+	if err = ctx.Valid(&reqBody); err != nil {
+		ctx.respParamError(err)
+		return
+	}
+
+	if calendar, err = ctx.getEditableCalendar(reqBody.CalendarID); err != nil {
+		ctx.respNotAllowed()
+		return
+	}
+
+	if err = models.DB().Delete(&calendar).Error; err != nil {
+		ctx.respDBError(err)
+		return
+	}
+
+	ctx.pubEvent(calendar.Name, event_DelCalendar, "", reqBody)
+	ctx.respSucc("", nil)
+}
+
+// ImportCalendar 从.ics文件导入排除日期
+// 未指定calendarID时以name新建日历
+func ImportCalendar(ctx *myctx) {
+	var (
+		err      error
+		reqBody  ImportCalendarReqParams
+		calendar models.Calendar
+		ranges   []crontab.DateRange
+	)
+
+	if err = ctx.Valid(&reqBody); err != nil {
+		ctx.respParamError(err)
+		return
+	}
+
+	if ranges, err = crontab.ParseICS(strings.NewReader(reqBody.Content)); err != nil {
+		ctx.respParamError(err)
+		return
+	}
+
+	if reqBody.CalendarID != 0 {
+		if calendar, err = ctx.getEditableCalendar(reqBody.CalendarID); err != nil {
+			ctx.respNotAllowed()
+			return
+		}
+	} else if !ctx.isSuper() && !ctx.isRoot() {
+		ctx.respNotAllowed()
+		return
+	} else {
+		calendar.Name = reqBody.Name
+		calendar.GroupID = ctx.claims.GroupID
+		calendar.CreatedUserID = ctx.claims.UserID
+		calendar.CreatedUsername = ctx.claims.Username
+	}
+
+	if reqBody.Replace {
+		calendar.Excludes = nil
+	}
+	for _, v := range ranges {
+		calendar.Excludes = append(calendar.Excludes, models.CalendarDate{
+			Name:  v.Name,
+			Start: v.Start.String(),
+			End:   v.End.String(),
+		})
+	}
+
+	if err = models.DB().Save(&calendar).Error; err != nil {
+		ctx.respDBError(err)
+		return
+	}
+
+	ctx.pubEvent(calendar.Name, event_ImportCalendar, "", map[string]interface{}{
+		"calendarID": calendar.ID,
+		"imported":   len(ranges),
+		"replace":    reqBody.Replace,
+	})
+	ctx.respSucc("", calendar)
+}
+
+// getEditableCalendar 获得当前用户可以编辑的日历
+func (ctx *myctx) getEditableCalendar(id uint) (models.Calendar, error) {
+	var calendar models.Calendar
+	if err := models.DB().Take(&calendar, "id=?", id).Error; err != nil {
+		return calendar, err
+	}
+	if ctx.isSuper() || (ctx.isRoot() && calendar.GroupID == ctx.claims.GroupID) {
+		return calendar, nil
+	}
+	return calendar, errors.New(proto.Msg_NotAllowed)
+}
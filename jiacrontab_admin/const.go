@@ -10,6 +10,8 @@ const (
 	event_StartCronJob = "{sourceName}{username}启动了定时任务{targetName}"
 	event_ExecCronJob  = "{sourceName}{username}执行了定时任务{targetName}"
 	event_KillCronJob  = "{sourceName}{username}kill了定时任务进程{targetName}"
+	event_RunOnceJob   = "{sourceName}{username}设置了定时任务{targetName}的一次性执行"
+	event_CancelOneOff = "{sourceName}{username}取消了定时任务{targetName}的一次性执行"
 
 	event_EditDaemonJob  = "{sourceName}{username}编辑了常驻任务{targetName}"
 	event_DelDaemonJob   = "{sourceName}{username}删除了常驻任务{targetName}"
@@ -25,6 +27,11 @@ const (
 	event_GroupUser       = "{username}将用户{sourceUsername}设置为{targetName}组"
 	event_AuditCrontabJob = "{sourceName}{username}审核了定时任务{targetName}"
 	event_AuditDaemonJob  = "{sourceName}{username}审核了常驻任务{targetName}"
+	event_ExpireCronJob   = "{sourceName}定时任务{targetName}已过期"
+
+	event_EditCalendar   = "{username}编辑了排除日历{targetName}"
+	event_DelCalendar    = "{username}删除了排除日历{targetName}"
+	event_ImportCalendar = "{username}向排除日历{targetName}导入了日期"
 
 	event_CleanJobHistory = "{username}清除了{targetName}前的任务执行记录"
 	event_CleanUserEvent  = "{username}清除了{targetName}前的用户动态"
@@ -41,6 +41,66 @@ func GetJobList(ctx *myctx) {
 	})
 }
 
+// SchedulePreview 预览定时规则接下来的执行时间
+// 定时规则错误时返回各字段的错误及其在cron表达式中的位置
+func SchedulePreview(ctx *myctx) {
+	var (
+		err     error
+		reqBody SchedulePreviewReqParams
+		reply   proto.SchedulePreviewReply
+	)
+
+	if err = ctx.Valid(&reqBody); err != nil {
+		ctx.respParamError(err)
+		return
+	}
+
+	if !ctx.verifyNodePermission(reqBody.Addr) {
+		ctx.respNotAllowed()
+		return
+	}
+
+	if err = rpcCall(reqBody.Addr, "CrontabJob.SchedulePreview", proto.SchedulePreviewArgs{
+		JobID:     reqBody.JobID,
+		CronExpr:  reqBody.CronExpr,
+		Calendars: reqBody.Calendars,
+		Num:       reqBody.Num,
+
+		CalendarRules: reqBody.calendars,
+
+		ActiveFrom:  reqBody.ActiveFrom,
+		ActiveUntil: reqBody.ActiveUntil,
+
+		ScheduleType: reqBody.ScheduleType,
+		Interval:     reqBody.Interval,
+		TimeArgs: models.TimeArgs{
+			Month:       reqBody.Month,
+			Day:         reqBody.Day,
+			Hour:        reqBody.Hour,
+			Minute:      reqBody.Minute,
+			Weekday:     reqBody.Weekday,
+			Second:      reqBody.Second,
+			Year:        reqBody.Year,
+			Timezone:    reqBody.Timezone,
+			DSTRepeated: reqBody.DSTRepeated,
+			DSTSkipped:  reqBody.DSTSkipped,
+			Jitter:      reqBody.Jitter,
+			Spread:      reqBody.Spread,
+		},
+	}, &reply); err != nil {
+		ctx.respRPCError(err)
+		return
+	}
+
+	ctx.respSucc("", map[string]interface{}{
+		"times":       reply.Times,
+		"description": reply.Description,
+		"errors":      reply.Errors,
+		"skipped":     reply.Skipped,
+		"valid":       len(reply.Errors) == 0,
+	})
+}
+
 func GetRecentLog(ctx *myctx) {
 	var (
 		err       error
@@ -64,6 +124,7 @@ func GetRecentLog(ctx *myctx) {
 		UserID:   ctx.claims.UserID,
 		Pattern:  reqBody.Pattern,
 		IsTail:   reqBody.IsTail,
+		Stream:   reqBody.Stream,
 	}, &searchRet); err != nil {
 		ctx.respRPCError(err)
 		return
@@ -99,40 +160,71 @@ func EditJob(ctx *myctx) {
 	}
 
 	job = models.CrontabJob{
-		Name:    reqBody.Name,
-		Command: reqBody.Command,
-		GroupID: ctx.claims.GroupID,
-		Code:    reqBody.Code,
+		Name:     reqBody.Name,
+		Command:  reqBody.Command,
+		GroupID:  ctx.claims.GroupID,
+		Code:     reqBody.Code,
+		CronExpr: reqBody.CronExpr,
 		TimeArgs: models.TimeArgs{
-			Month:   reqBody.Month,
-			Day:     reqBody.Day,
-			Hour:    reqBody.Hour,
-			Minute:  reqBody.Minute,
-			Weekday: reqBody.Weekday,
-			Second:  reqBody.Second,
+			Month:    reqBody.Month,
+			Day:      reqBody.Day,
+			Hour:     reqBody.Hour,
+			Minute:   reqBody.Minute,
+			Weekday:  reqBody.Weekday,
+			Second:   reqBody.Second,
+			Year:     reqBody.Year,
+			Timezone: reqBody.Timezone,
+
+			DSTRepeated: reqBody.DSTRepeated,
+			DSTSkipped:  reqBody.DSTSkipped,
+			Jitter:      reqBody.Jitter,
+			Spread:      reqBody.Spread,
 		},
 
-		UpdatedUserID:    ctx.claims.UserID,
-		UpdatedUsername:  ctx.claims.Username,
-		WorkDir:          reqBody.WorkDir,
-		WorkUser:         reqBody.WorkUser,
-		WorkIp:           reqBody.WorkIp,
-		WorkEnv:          reqBody.WorkEnv,
-		KillChildProcess: reqBody.KillChildProcess,
-		RetryNum:         reqBody.RetryNum,
-		Timeout:          reqBody.Timeout,
-		TimeoutTrigger:   reqBody.TimeoutTrigger,
-		MailTo:           reqBody.MailTo,
-		APITo:            reqBody.APITo,
-		DingdingTo:       reqBody.DingdingTo,
-		MaxConcurrent:    reqBody.MaxConcurrent,
-		DependJobs:       reqBody.DependJobs,
-		ErrorMailNotify:  reqBody.ErrorMailNotify,
-		ErrorAPINotify:   reqBody.ErrorAPINotify,
-		ErrorDingdingNotify:   reqBody.ErrorDingdingNotify,
-		IsSync:           reqBody.IsSync,
-		CreatedUserID:    ctx.claims.UserID,
-		CreatedUsername:  ctx.claims.Username,
+		UpdatedUserID:       ctx.claims.UserID,
+		UpdatedUsername:     ctx.claims.Username,
+		WorkDir:             reqBody.WorkDir,
+		WorkUser:            reqBody.WorkUser,
+		WorkIp:              reqBody.WorkIp,
+		WorkEnv:             reqBody.WorkEnv,
+		KillChildProcess:    reqBody.KillChildProcess,
+		RetryNum:            reqBody.RetryNum,
+		Timeout:             reqBody.Timeout,
+		TimeoutTrigger:      reqBody.TimeoutTrigger,
+		MailTo:              reqBody.MailTo,
+		APITo:               reqBody.APITo,
+		DingdingTo:          reqBody.DingdingTo,
+		MaxConcurrent:       reqBody.MaxConcurrent,
+		DependJobs:          reqBody.DependJobs,
+		ErrorMailNotify:     reqBody.ErrorMailNotify,
+		ErrorAPINotify:      reqBody.ErrorAPINotify,
+		ErrorDingdingNotify: reqBody.ErrorDingdingNotify,
+		IsSync:              reqBody.IsSync,
+		MisfirePolicy:       reqBody.MisfirePolicy,
+		MisfireLimit:        reqBody.MisfireLimit,
+		Calendars:           reqBody.Calendars,
+		CalendarRules:       reqBody.calendars,
+		ActiveFrom:          reqBody.ActiveFrom,
+		ActiveUntil:         reqBody.ActiveUntil,
+		ScheduleType:        reqBody.ScheduleType,
+		Interval:            reqBody.Interval,
+		ConcurrencyPolicy:   reqBody.ConcurrencyPolicy,
+		MaxQueued:           reqBody.MaxQueued,
+		PriorityClass:       reqBody.PriorityClass,
+		Locks:               reqBody.Locks,
+		ClusterLock:         reqBody.ClusterLock,
+		RetryPolicy:         reqBody.RetryPolicy,
+		SuccessRule:         reqBody.SuccessRule,
+		StopSignal:          reqBody.StopSignal,
+		StopGracePeriod:     reqBody.StopGracePeriod,
+		Limits:              reqBody.Limits,
+		Nice:                reqBody.Nice,
+		IOClass:             reqBody.IOClass,
+		IOPriority:          reqBody.IOPriority,
+		MaxOutputSize:       reqBody.MaxOutputSize,
+		MaxLogSize:          reqBody.MaxLogSize,
+		CreatedUserID:       ctx.claims.UserID,
+		CreatedUsername:     ctx.claims.Username,
 	}
 
 	job.ID = reqBody.JobID
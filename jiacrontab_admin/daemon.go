@@ -128,6 +128,16 @@ func EditDaemonJob(ctx *myctx) {
 		Code:            reqBody.Code,
 		RetryNum:        reqBody.RetryNum,
 		FailRestart:     reqBody.FailRestart,
+		Locks:           reqBody.Locks,
+		ClusterLock:     reqBody.ClusterLock,
+		SuccessRule:     reqBody.SuccessRule,
+		StopSignal:      reqBody.StopSignal,
+		StopGracePeriod: reqBody.StopGracePeriod,
+		Limits:          reqBody.Limits,
+		Nice:            reqBody.Nice,
+		IOClass:         reqBody.IOClass,
+		IOPriority:      reqBody.IOPriority,
+		MaxLogSize:      reqBody.MaxLogSize,
 		Status:          models.StatusJobUnaudited,
 		CreatedUserID:   ctx.claims.UserID,
 		CreatedUsername: ctx.claims.Username,
@@ -206,6 +216,7 @@ func GetRecentDaemonLog(ctx *myctx) {
 		Date:     reqBody.Date,
 		Pattern:  reqBody.Pattern,
 		IsTail:   reqBody.IsTail,
+		Stream:   reqBody.Stream,
 	}, &searchRet); err != nil {
 		ctx.respRPCError(err)
 		return
@@ -0,0 +1,109 @@
+package admin
+
+import (
+	"jiacrontab/models"
+	"jiacrontab/pkg/proto"
+	"strings"
+)
+
+// RunJobOnce 在指定时刻或一段时间后执行一次job
+func RunJobOnce(ctx *myctx) {
+	var (
+		err     error
+		reqBody RunOnceReqParams
+		reply   models.OneOffRun
+	)
+
+	if err = ctx.Valid(&reqBody); err != nil {
+		ctx.respParamError(err)
+		return
+	}
+
+	if err = rpcCall(reqBody.Addr, "CrontabJob.RunOnce", proto.RunOnceArgs{
+		UserID:   ctx.claims.UserID,
+		Username: ctx.claims.Username,
+		GroupID:  ctx.claims.GroupID,
+		Root:     ctx.claims.Root,
+		JobID:    reqBody.JobID,
+		RunAt:    reqBody.RunAt,
+		Delay:    reqBody.delay,
+		Command:  reqBody.Command,
+		Code:     reqBody.Code,
+		WorkEnv:  reqBody.WorkEnv,
+		WorkDir:  reqBody.WorkDir,
+		Timeout:  reqBody.Timeout,
+	}, &reply); err != nil {
+		ctx.respRPCError(err)
+		return
+	}
+
+	ctx.pubEvent(reply.JobName, event_RunOnceJob, models.EventSourceName(reqBody.Addr), reqBody)
+	ctx.respSucc("", reply)
+}
+
+// GetOneOffList 一次性执行列表
+func GetOneOffList(ctx *myctx) {
+	var (
+		err     error
+		reqBody GetOneOffListReqParams
+		ret     proto.QueryOneOffRet
+	)
+
+	if err = ctx.Valid(&reqBody); err != nil {
+		ctx.respParamError(err)
+		return
+	}
+
+	if err = rpcCall(reqBody.Addr, "CrontabJob.OneOffList", proto.QueryOneOffArgs{
+		UserID:   ctx.claims.UserID,
+		GroupID:  ctx.claims.GroupID,
+		Root:     ctx.claims.Root,
+		JobID:    reqBody.JobID,
+		Status:   reqBody.Status,
+		Page:     reqBody.Page,
+		Pagesize: reqBody.Pagesize,
+	}, &ret); err != nil {
+		ctx.respRPCError(err)
+		return
+	}
+
+	ctx.respSucc("", map[string]interface{}{
+		"list":     ret.List,
+		"page":     ret.Page,
+		"pagesize": ret.Pagesize,
+		"total":    ret.Total,
+	})
+}
+
+// CancelOneOff 取消等待中的一次性执行
+func CancelOneOff(ctx *myctx) {
+	var (
+		err     error
+		reqBody CancelOneOffReqParams
+		reply   []models.OneOffRun
+	)
+
+	if err = ctx.Valid(&reqBody); err != nil {
+		ctx.respParamError(err)
+		return
+	}
+
+	if err = rpcCall(reqBody.Addr, "CrontabJob.CancelOneOffs", proto.CancelOneOffArgs{
+		UserID:  ctx.claims.UserID,
+		GroupID: ctx.claims.GroupID,
+		Root:    ctx.claims.Root,
+		IDs:     reqBody.IDs,
+	}, &reply); err != nil {
+		ctx.respRPCError(err)
+		return
+	}
+
+	if len(reply) > 0 {
+		var targetNames []string
+		for _, v := range reply {
+			targetNames = append(targetNames, v.JobName)
+		}
+		ctx.pubEvent(strings.Join(targetNames, ","), event_CancelOneOff, models.EventSourceName(reqBody.Addr), reqBody)
+	}
+	ctx.respSucc("", reply)
+}
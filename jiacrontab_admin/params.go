@@ -4,9 +4,12 @@ import (
 	"errors"
 	"fmt"
 	"jiacrontab/models"
+	"jiacrontab/pkg/crontab"
+	"jiacrontab/pkg/kproc"
 	"jiacrontab/pkg/proto"
 	"jiacrontab/pkg/util"
 	"strings"
+	"time"
 )
 
 var (
@@ -71,7 +74,39 @@ type EditJobReqParams struct {
 	Hour                string            `json:"hour"`
 	Minute              string            `json:"minute"`
 	Second              string            `json:"second"`
+	Year                string            `json:"year"`
+	CronExpr            string            `json:"cronExpr"`
+	Timezone            string            `json:"timezone"`
+	DSTRepeated         string            `json:"dstRepeated"`
+	DSTSkipped          string            `json:"dstSkipped"`
+	Jitter              int               `json:"jitter"`
+	Spread              int               `json:"spread"`
+	MisfirePolicy       string            `json:"misfirePolicy"`
+	MisfireLimit        int               `json:"misfireLimit"`
+	Calendars           []uint            `json:"calendars"`
+	ActiveFrom          time.Time         `json:"activeFrom"`
+	ActiveUntil         time.Time         `json:"activeUntil"`
+	ScheduleType        string            `json:"scheduleType"`
+	Interval            int               `json:"interval"`
+	ConcurrencyPolicy   string            `json:"concurrencyPolicy"`
+	MaxQueued           int               `json:"maxQueued"`
+	PriorityClass       string            `json:"priorityClass"`
+	Locks               []string          `json:"locks"`
+	ClusterLock         bool              `json:"clusterLock"`
 	TimeoutTrigger      []string          `json:"timeoutTrigger"`
+
+	RetryPolicy     models.RetryPolicy `json:"retryPolicy"`
+	SuccessRule     models.SuccessRule `json:"successRule"`
+	StopSignal      string             `json:"stopSignal"`
+	StopGracePeriod int                `json:"stopGracePeriod"`
+	Limits          models.ProcLimits  `json:"limits"`
+	Nice            int                `json:"nice"`
+	IOClass         string             `json:"ioClass"`
+	IOPriority      int                `json:"ioPriority"`
+	MaxOutputSize   int                `json:"maxOutputSize"`
+	MaxLogSize      int                `json:"maxLogSize"`
+
+	calendars []models.Calendar // 由Verify查出,随job下发到节点
 }
 
 func (p *EditJobReqParams) Verify(ctx *myctx) error {
@@ -94,6 +129,7 @@ func (p *EditJobReqParams) Verify(ctx *myctx) error {
 	p.DingdingTo = util.FilterEmptyEle(p.DingdingTo)
 	p.WorkEnv = util.FilterEmptyEle(p.WorkEnv)
 	p.WorkIp = util.FilterEmptyEle(p.WorkIp)
+	p.Locks = verifyLocks(p.Locks)
 
 	if p.Month == "" {
 		p.Month = "*"
@@ -119,6 +155,272 @@ func (p *EditJobReqParams) Verify(ctx *myctx) error {
 		p.Second = "*"
 	}
 
+	p.Year = strings.TrimSpace(p.Year)
+	p.CronExpr = strings.TrimSpace(p.CronExpr)
+	p.Timezone = strings.TrimSpace(p.Timezone)
+
+	if p.DSTRepeated == "" {
+		p.DSTRepeated = crontab.DSTRepeatedOnce
+	}
+
+	if p.DSTSkipped == "" {
+		p.DSTSkipped = crontab.DSTSkippedFirstValid
+	}
+
+	switch p.MisfirePolicy {
+	case "":
+		p.MisfirePolicy = models.MisfireSkip
+	case models.MisfireSkip, models.MisfireRunOnce, models.MisfireRunAll:
+	default:
+		return fmt.Errorf("misfirePolicy %s:%v", p.MisfirePolicy, paramsError)
+	}
+
+	if p.Jitter < 0 || p.Spread < 0 {
+		return fmt.Errorf("jitter/spread:%v", paramsError)
+	}
+
+	if p.MisfireLimit < 0 {
+		return fmt.Errorf("misfireLimit:%v", paramsError)
+	}
+
+	switch p.ConcurrencyPolicy {
+	case "":
+		p.ConcurrencyPolicy = models.ConcurrencyDrop
+	case models.ConcurrencyDrop, models.ConcurrencyQueue, models.ConcurrencyReplace, models.ConcurrencySkipAlert:
+	default:
+		return fmt.Errorf("concurrencyPolicy %s:%v", p.ConcurrencyPolicy, paramsError)
+	}
+
+	if p.MaxQueued < 0 {
+		return fmt.Errorf("maxQueued:%v", paramsError)
+	}
+
+	switch p.PriorityClass {
+	case "":
+		p.PriorityClass = models.PriorityNormal
+	case models.PriorityHigh, models.PriorityNormal, models.PriorityLow:
+	default:
+		return fmt.Errorf("priorityClass %s:%v", p.PriorityClass, paramsError)
+	}
+
+	if err := p.RetryPolicy.Validate(); err != nil {
+		return fmt.Errorf("retryPolicy %v:%v", err, paramsError)
+	}
+
+	if err := p.SuccessRule.Validate(); err != nil {
+		return fmt.Errorf("successRule %v:%v", err, paramsError)
+	}
+
+	if err := verifyStop(p.StopSignal, p.StopGracePeriod); err != nil {
+		return err
+	}
+
+	if err := p.Limits.Validate(); err != nil {
+		return fmt.Errorf("limits %v:%v", err, paramsError)
+	}
+
+	if err := verifyNice(p.Nice, p.IOClass, p.IOPriority); err != nil {
+		return err
+	}
+
+	if p.MaxOutputSize < 0 || p.MaxLogSize < 0 {
+		return fmt.Errorf("maxOutputSize和maxLogSize不能小于0:%v", paramsError)
+	}
+
+	var err error
+	if p.calendars, err = verifyCalendars(ctx, p.Calendars); err != nil {
+		return err
+	}
+
+	if !p.ActiveFrom.IsZero() && !p.ActiveUntil.IsZero() && !p.ActiveUntil.After(p.ActiveFrom) {
+		return fmt.Errorf("activeUntil应晚于activeFrom:%v", paramsError)
+	}
+
+	if err := verifyScheduleType(&p.ScheduleType, p.Interval); err != nil {
+		return err
+	}
+
+	job := crontab.Job{
+		Second:      p.Second,
+		Minute:      p.Minute,
+		Hour:        p.Hour,
+		Day:         p.Day,
+		Month:       p.Month,
+		Weekday:     p.Weekday,
+		Year:        p.Year,
+		Expr:        p.CronExpr,
+		Timezone:    p.Timezone,
+		DSTRepeated: p.DSTRepeated,
+		DSTSkipped:  p.DSTSkipped,
+	}
+	if err := job.Validate(); err != nil {
+		return fmt.Errorf("时间格式错误: %v", err)
+	}
+
+	return nil
+}
+
+type SchedulePreviewReqParams struct {
+	Addr        string    `json:"addr" rule:"required,请填写addr"`
+	JobID       uint      `json:"jobID"`
+	Num         int       `json:"num"`
+	Month       string    `json:"month"`
+	Weekday     string    `json:"weekday"`
+	Day         string    `json:"day"`
+	Hour        string    `json:"hour"`
+	Minute      string    `json:"minute"`
+	Second      string    `json:"second"`
+	Year        string    `json:"year"`
+	CronExpr    string    `json:"cronExpr"`
+	Timezone    string    `json:"timezone"`
+	DSTRepeated string    `json:"dstRepeated"`
+	DSTSkipped  string    `json:"dstSkipped"`
+	Jitter      int       `json:"jitter"`
+	Spread      int       `json:"spread"`
+	Calendars   []uint    `json:"calendars"`
+	ActiveFrom  time.Time `json:"activeFrom"`
+	ActiveUntil time.Time `json:"activeUntil"`
+	// ScheduleType 调度方式,Interval 固定间隔秒数
+	ScheduleType string `json:"scheduleType"`
+	Interval     int    `json:"interval"`
+
+	calendars []models.Calendar
+}
+
+func (p *SchedulePreviewReqParams) Verify(ctx *myctx) error {
+	if p.Num <= 0 {
+		p.Num = 10
+	}
+	if p.Num > 100 {
+		p.Num = 100
+	}
+
+	for _, v := range []*string{&p.Month, &p.Weekday, &p.Day, &p.Hour, &p.Minute, &p.Second} {
+		if *v = strings.TrimSpace(*v); *v == "" {
+			*v = "*"
+		}
+	}
+
+	p.Year = strings.TrimSpace(p.Year)
+	p.CronExpr = strings.TrimSpace(p.CronExpr)
+	p.Timezone = strings.TrimSpace(p.Timezone)
+
+	if p.Jitter < 0 || p.Spread < 0 {
+		return fmt.Errorf("jitter/spread:%v", paramsError)
+	}
+	var err error
+	if p.calendars, err = verifyCalendars(ctx, p.Calendars); err != nil {
+		return err
+	}
+	return verifyScheduleType(&p.ScheduleType, p.Interval)
+}
+
+// verifyScheduleType 检查调度方式,固定间隔调度的间隔至少为1秒
+func verifyScheduleType(scheduleType *string, interval int) error {
+	switch *scheduleType {
+	case "":
+		*scheduleType = models.ScheduleCron
+	case models.ScheduleCron:
+	case models.ScheduleFixedRate, models.ScheduleFixedDelay:
+		if interval < 1 {
+			return fmt.Errorf("interval:%v", paramsError)
+		}
+	default:
+		return fmt.Errorf("scheduleType %s:%v", *scheduleType, paramsError)
+	}
+	return nil
+}
+
+// verifyCalendars 检查引用的排除日历是否存在,非超级管理员组只能引用本组和超级管理员组的日历
+func verifyCalendars(ctx *myctx, ids []uint) ([]models.Calendar, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	set := make(map[uint]bool)
+	for _, id := range ids {
+		set[id] = true
+	}
+	var list []models.Calendar
+	if err := models.DB().Where("id in (?)", ids).Find(&list).Error; err != nil {
+		return nil, err
+	}
+	if len(list) != len(set) {
+		return nil, fmt.Errorf("calendars:%v", paramsError)
+	}
+	for _, v := range list {
+		if !ctx.isSuper() && v.GroupID != ctx.claims.GroupID && v.GroupID != models.SuperGroup.ID {
+			return nil, fmt.Errorf("calendar %s不属于当前分组:%v", v.Name, paramsError)
+		}
+	}
+	return list, nil
+}
+
+type GetCalendarListReqParams struct {
+	SearchTxt string `json:"searchTxt"`
+	PageReqParams
+}
+
+func (p *GetCalendarListReqParams) Verify(ctx *myctx) error {
+	if p.Page <= 1 {
+		p.Page = 1
+	}
+
+	if p.Pagesize <= 0 {
+		p.Pagesize = 50
+	}
+	return nil
+}
+
+type GetCalendarReqParams struct {
+	CalendarID uint `json:"calendarID" rule:"required,请填写calendarID"`
+}
+
+func (p *GetCalendarReqParams) Verify(ctx *myctx) error {
+	return nil
+}
+
+type EditCalendarReqParams struct {
+	CalendarID  uint                 `json:"calendarID"`
+	Name        string               `json:"name" rule:"required,请填写name"`
+	Description string               `json:"description"`
+	Excludes    models.CalendarDates `json:"excludes"`
+}
+
+func (p *EditCalendarReqParams) Verify(ctx *myctx) error {
+	p.Name = strings.TrimSpace(p.Name)
+	for k, v := range p.Excludes {
+		start, err := crontab.ParseDate(strings.TrimSpace(v.Start))
+		if err != nil {
+			return fmt.Errorf("excludes[%d]: %v", k, err)
+		}
+		end := start
+		if strings.TrimSpace(v.End) != "" {
+			if end, err = crontab.ParseDate(strings.TrimSpace(v.End)); err != nil {
+				return fmt.Errorf("excludes[%d]: %v", k, err)
+			}
+		}
+		if end.String() < start.String() {
+			return fmt.Errorf("excludes[%d]: end %s before start %s", k, end, start)
+		}
+		p.Excludes[k].Start, p.Excludes[k].End = start.String(), end.String()
+	}
+	return nil
+}
+
+type ImportCalendarReqParams struct {
+	CalendarID uint   `json:"calendarID"`
+	Name       string `json:"name"`
+	// Content .ics文件内容
+	Content string `json:"content" rule:"required,请填写content"`
+	// Replace 为true时替换已有的排除日期,否则追加
+	Replace bool `json:"replace"`
+}
+
+func (p *ImportCalendarReqParams) Verify(ctx *myctx) error {
+	p.Name = strings.TrimSpace(p.Name)
+	if p.CalendarID == 0 && p.Name == "" {
+		return fmt.Errorf("name:%v", paramsError)
+	}
 	return nil
 }
 
@@ -130,6 +432,7 @@ type GetLogReqParams struct {
 	IsTail   bool   `json:"isTail"`
 	Offset   int64  `json:"offset"`
 	Pagesize int    `json:"pagesize"`
+	Stream   string `json:"stream"`
 }
 
 func (p *GetLogReqParams) Verify(ctx *myctx) error {
@@ -138,6 +441,12 @@ func (p *GetLogReqParams) Verify(ctx *myctx) error {
 		p.Pagesize = 50
 	}
 
+	switch p.Stream {
+	case "", models.StreamStdout, models.StreamStderr, models.StreamSystem:
+	default:
+		return fmt.Errorf("stream %s:%v", p.Stream, paramsError)
+	}
+
 	return nil
 }
 
@@ -197,6 +506,81 @@ func (p *GetJobListReqParams) Verify(ctx *myctx) error {
 	return nil
 }
 
+type RunOnceReqParams struct {
+	Addr  string `json:"addr" rule:"required,请填写addr"`
+	JobID uint   `json:"jobID" rule:"required,请填写jobID"`
+	// RunAt 执行时刻,Delay 延迟执行的时长,例如2h30m,二者必填其一
+	RunAt   time.Time `json:"runAt"`
+	Delay   string    `json:"delay"`
+	Command []string  `json:"command"`
+	Code    string    `json:"code"`
+	WorkEnv []string  `json:"workEnv"`
+	WorkDir string    `json:"workDir"`
+	Timeout int       `json:"timeout"`
+
+	delay time.Duration
+}
+
+func (p *RunOnceReqParams) Verify(ctx *myctx) error {
+	var err error
+
+	p.Command = util.FilterEmptyEle(p.Command)
+	p.WorkEnv = util.FilterEmptyEle(p.WorkEnv)
+	p.Delay = strings.TrimSpace(p.Delay)
+
+	switch {
+	case p.RunAt.IsZero() == (p.Delay == ""):
+		return fmt.Errorf("runAt和delay必填其一:%v", paramsError)
+	case p.Delay != "":
+		if p.delay, err = time.ParseDuration(p.Delay); err != nil || p.delay < 0 {
+			return fmt.Errorf("delay %s:%v", p.Delay, paramsError)
+		}
+	case p.RunAt.Before(time.Now().Add(-time.Minute)):
+		return fmt.Errorf("runAt不能早于当前时间:%v", paramsError)
+	}
+
+	if p.Timeout < 0 {
+		return fmt.Errorf("timeout:%v", paramsError)
+	}
+
+	// 覆盖的命令未经审核,普通用户只能按job原有配置执行
+	override := len(p.Command) > 0 || p.Code != "" || len(p.WorkEnv) > 0 || p.WorkDir != ""
+	if override && !ctx.isRoot() && !ctx.isSuper() {
+		return fmt.Errorf("仅管理员可以覆盖command、code、workEnv、workDir:%v", paramsError)
+	}
+	return nil
+}
+
+type GetOneOffListReqParams struct {
+	Addr   string `json:"addr" rule:"required,请填写addr"`
+	JobID  uint   `json:"jobID"`
+	Status string `json:"status"`
+	PageReqParams
+}
+
+func (p *GetOneOffListReqParams) Verify(ctx *myctx) error {
+	if p.Page <= 1 {
+		p.Page = 1
+	}
+
+	if p.Pagesize <= 0 {
+		p.Pagesize = 50
+	}
+	return nil
+}
+
+type CancelOneOffReqParams struct {
+	Addr string `json:"addr" rule:"required,请填写addr"`
+	IDs  []uint `json:"ids" rule:"required,请填写ids"`
+}
+
+func (p *CancelOneOffReqParams) Verify(ctx *myctx) error {
+	if len(p.IDs) == 0 {
+		return paramsError
+	}
+	return nil
+}
+
 type GetGroupListReqParams struct {
 	SearchTxt string `json:"searchTxt"`
 	PageReqParams
@@ -245,6 +629,17 @@ type EditDaemonJobReqParams struct {
 	ErrorMailNotify     bool     `json:"errorMailNotify"`
 	ErrorAPINotify      bool     `json:"errorAPINotify"`
 	ErrorDingdingNotify bool     `json:"errorDingdingNotify"`
+	Locks               []string `json:"locks"`
+	ClusterLock         bool     `json:"clusterLock"`
+
+	SuccessRule     models.SuccessRule `json:"successRule"`
+	StopSignal      string             `json:"stopSignal"`
+	StopGracePeriod int                `json:"stopGracePeriod"`
+	Limits          models.ProcLimits  `json:"limits"`
+	Nice            int                `json:"nice"`
+	IOClass         string             `json:"ioClass"`
+	IOPriority      int                `json:"ioPriority"`
+	MaxLogSize      int                `json:"maxLogSize"`
 }
 
 func (p *EditDaemonJobReqParams) Verify(ctx *myctx) error {
@@ -253,9 +648,70 @@ func (p *EditDaemonJobReqParams) Verify(ctx *myctx) error {
 	p.Command = util.FilterEmptyEle(p.Command)
 	p.WorkEnv = util.FilterEmptyEle(p.WorkEnv)
 	p.WorkIp = util.FilterEmptyEle(p.WorkIp)
+	p.Locks = verifyLocks(p.Locks)
+	if err := p.SuccessRule.Validate(); err != nil {
+		return fmt.Errorf("successRule %v:%v", err, paramsError)
+	}
+	if err := p.Limits.Validate(); err != nil {
+		return fmt.Errorf("limits %v:%v", err, paramsError)
+	}
+	if err := verifyNice(p.Nice, p.IOClass, p.IOPriority); err != nil {
+		return err
+	}
+	if p.MaxLogSize < 0 {
+		return fmt.Errorf("maxLogSize不能小于0:%v", paramsError)
+	}
+	return verifyStop(p.StopSignal, p.StopGracePeriod)
+}
+
+// verifyNice 检查nice值和IO优先级,idle类型没有优先级
+func verifyNice(nice int, ioClass string, ioPriority int) error {
+	if nice < -20 || nice > 19 {
+		return fmt.Errorf("nice应在-20至19之间:%v", paramsError)
+	}
+	switch ioClass {
+	case "", models.IOClassIdle:
+		if ioPriority != 0 {
+			return fmt.Errorf("ioPriority:%v", paramsError)
+		}
+	case models.IOClassRealtime, models.IOClassBestEffort:
+		if ioPriority < 0 || ioPriority > 7 {
+			return fmt.Errorf("ioPriority应在0至7之间:%v", paramsError)
+		}
+	default:
+		return fmt.Errorf("ioClass %s:%v", ioClass, paramsError)
+	}
+	return nil
+}
+
+// verifyStop 检查停止信号和宽限时间
+func verifyStop(signal string, gracePeriod int) error {
+	if _, err := kproc.ParseSignal(signal); err != nil {
+		return fmt.Errorf("stopSignal %v:%v", err, paramsError)
+	}
+	if gracePeriod < 0 {
+		return fmt.Errorf("stopGracePeriod:%v", paramsError)
+	}
 	return nil
 }
 
+// verifyLocks 去除锁名称两端的空白和重复的锁
+func verifyLocks(names []string) []string {
+	var (
+		ret  []string
+		seen = make(map[string]bool)
+	)
+	for _, v := range names {
+		v = strings.TrimSpace(v)
+		if v == "" || seen[v] {
+			continue
+		}
+		seen[v] = true
+		ret = append(ret, v)
+	}
+	return ret
+}
+
 type GetJobReqParams struct {
 	JobID uint   `json:"jobID" rule:"required,请填写jobID"`
 	Addr  string `json:"addr" rule:"required,请填写addr"`
@@ -385,6 +841,14 @@ func (p *ReadMoreReqParams) Verify(ctx *myctx) error {
 	return nil
 }
 
+// GetJobHistoryReqParams 按节点和job筛选执行记录,用于查看单个job的资源使用趋势
+type GetJobHistoryReqParams struct {
+	ReadMoreReqParams
+	Addr    string         `json:"addr"`
+	JobID   uint           `json:"jobID"`
+	JobType models.JobType `json:"jobType"`
+}
+
 type GroupNodeReqParams struct {
 	Addr            string `json:"addr" rule:"required,请填写addr"`
 	TargetNodeName  string `json:"targetNodeName"`
@@ -1,6 +1,7 @@
 package admin
 
 import (
+	"encoding/json"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -103,6 +104,53 @@ func (s *Srv) PushJobLog(args models.JobHistory, reply *bool) error {
 	return nil
 }
 
+// PubJobEvent 记录节点上报的job动态
+func (s *Srv) PubJobEvent(args proto.JobEventArgs, reply *bool) error {
+	var desc string
+	switch args.Event {
+	case proto.JobEvent_Expired:
+		desc = event_ExpireCronJob
+	default:
+		return fmt.Errorf("unknown job event %s", args.Event)
+	}
+
+	content, _ := json.Marshal(args)
+	e := models.Event{
+		GroupID:    args.GroupID,
+		EventDesc:  desc,
+		TargetName: args.JobName,
+		SourceName: args.Addr,
+		Content:    string(content),
+	}
+	e.Pub()
+	*reply = true
+	return nil
+}
+
+// GetCalendars 获得节点调度时使用的排除日历
+func (s *Srv) GetCalendars(args proto.GetCalendarsArgs, reply *[]models.Calendar) error {
+	if len(args.IDs) == 0 {
+		return nil
+	}
+	return models.DB().Where("id in (?)", args.IDs).Find(reply).Error
+}
+
+// AcquireLocks 为节点取得集群锁,锁被占用时reply为false
+func (s *Srv) AcquireLocks(args proto.LockArgs, reply *bool) error {
+	if len(args.Names) == 0 || args.Holder == "" || args.Lease <= 0 {
+		return fmt.Errorf("invalid lock args")
+	}
+	var err error
+	*reply, err = models.AcquireLocks(args.Addr, args.Holder, args.Names, args.Lease)
+	return err
+}
+
+// ReleaseLocks 释放节点持有的集群锁
+func (s *Srv) ReleaseLocks(args proto.LockArgs, reply *bool) error {
+	*reply = true
+	return models.ReleaseLocks(args.Addr, args.Holder, args.Names)
+}
+
 func (s *Srv) ApiPost(args proto.ApiPost, reply *bool) error {
 	var (
 		err  error
@@ -140,7 +140,7 @@ func GetActivityList(ctx *myctx) {
 func GetJobHistory(ctx *myctx) {
 	var (
 		err      error
-		reqBody  ReadMoreReqParams
+		reqBody  GetJobHistoryReqParams
 		historys []models.JobHistory
 		addrs    []string
 		model    = models.DB()
@@ -163,6 +163,14 @@ func GetJobHistory(ctx *myctx) {
 			txt, txt, txt)
 	}
 
+	if reqBody.Addr != "" {
+		model = model.Where("addr=?", reqBody.Addr)
+	}
+
+	if reqBody.JobID != 0 {
+		model = model.Where("job_id=? and job_type=?", reqBody.JobID, reqBody.JobType)
+	}
+
 	if reqBody.LastID == 0 {
 		if !isSuper {
 			model = model.Where("addr in (?)", addrs)
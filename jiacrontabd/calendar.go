@@ -0,0 +1,170 @@
+package jiacrontabd
+
+import (
+	"context"
+	"fmt"
+	"jiacrontab/models"
+	"jiacrontab/pkg/crontab"
+	"jiacrontab/pkg/proto"
+	"sync"
+	"time"
+
+	"github.com/iwannay/log"
+)
+
+type calendarEntry struct {
+	calendar  *crontab.Calendar
+	version   time.Time // 日历在admin中的修改时间
+	updatedAt time.Time
+}
+
+// calendars 缓存从admin获取的排除日历
+// 超过client_alive_interval未更新的日历在后台重新获取,调度时不等待admin
+type calendars struct {
+	jd         *Jiacrontabd
+	mux        sync.RWMutex
+	items      map[uint]*calendarEntry // calendar为nil表示admin中已删除
+	refreshing map[uint]bool
+	// pending 因获取不到日历暂停调度的job,值为true时调度前需处理重启期间错过的执行
+	pending map[uint]bool
+}
+
+func newCalendars(jd *Jiacrontabd) *calendars {
+	return &calendars{
+		jd:         jd,
+		items:      make(map[uint]*calendarEntry),
+		refreshing: make(map[uint]bool),
+		pending:    make(map[uint]bool),
+	}
+}
+
+// get 获得ids对应的排除日历,缓存和编辑job时admin下发的日历中使用修改时间较晚的一个
+// 获取失败时保留上次获取到的日历,不会丢弃排除日期,从未获取到的日历返回错误
+func (c *calendars) get(ids []uint, pushed []models.Calendar) ([]*crontab.Calendar, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	ttl := time.Duration(c.jd.getOpts().ClientAliveInterval) * time.Second
+	var (
+		list    []*crontab.Calendar
+		stale   []uint
+		missing []uint
+	)
+	c.mux.Lock()
+	for _, id := range ids {
+		v, ok := c.items[id]
+		if !ok || time.Since(v.updatedAt) > ttl {
+			if !c.refreshing[id] {
+				c.refreshing[id] = true
+				stale = append(stale, id)
+			}
+		}
+		cal, found := findCalendar(pushed, id)
+		switch {
+		case ok && v.calendar == nil:
+			// admin中已删除的日历不再生效
+		case ok && (!found || !cal.UpdatedAt.After(v.version)):
+			list = append(list, v.calendar)
+		case found:
+			list = append(list, newCalendar(cal))
+		default:
+			missing = append(missing, id)
+		}
+	}
+	c.mux.Unlock()
+
+	if len(stale) > 0 {
+		go c.refresh(stale)
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("calendars %v not found", missing)
+	}
+	return list, nil
+}
+
+// wait 记录因获取不到日历暂停调度的job,获取到日历后由schedulePending重新调度
+func (c *calendars) wait(jobID uint, recovered bool) {
+	c.mux.Lock()
+	c.pending[jobID] = c.pending[jobID] || recovered
+	c.mux.Unlock()
+}
+
+// takePending 取出所有等待日历的job
+func (c *calendars) takePending() map[uint]bool {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	ret := c.pending
+	c.pending = make(map[uint]bool)
+	return ret
+}
+
+func findCalendar(list []models.Calendar, id uint) (models.Calendar, bool) {
+	for _, v := range list {
+		if v.ID == id {
+			return v, true
+		}
+	}
+	return models.Calendar{}, false
+}
+
+func (c *calendars) refresh(ids []uint) {
+	var reply []models.Calendar
+	err := c.jd.rpcCallCtx(context.TODO(), "Srv.GetCalendars", proto.GetCalendarsArgs{IDs: ids}, &reply)
+
+	now := time.Now()
+	c.mux.Lock()
+	for _, id := range ids {
+		delete(c.refreshing, id)
+	}
+	if err != nil {
+		c.mux.Unlock()
+		log.Error("rpc call Srv.GetCalendars failed:", err)
+		return
+	}
+	// admin中已删除的日历记为nil,不再生效
+	for _, id := range ids {
+		c.items[id] = &calendarEntry{updatedAt: now}
+	}
+	for _, v := range reply {
+		c.items[v.ID] = &calendarEntry{
+			calendar:  newCalendar(v),
+			version:   v.UpdatedAt,
+			updatedAt: now,
+		}
+	}
+	pending := len(c.pending) > 0
+	c.mux.Unlock()
+
+	if pending {
+		c.jd.schedulePending()
+	}
+}
+
+// newCalendar 将admin中的日历转换为调度器使用的日历,忽略格式错误的日期
+func newCalendar(c models.Calendar) *crontab.Calendar {
+	cal := &crontab.Calendar{
+		ID:   c.ID,
+		Name: c.Name,
+	}
+	for _, v := range c.Excludes {
+		start, err := crontab.ParseDate(v.Start)
+		if err != nil {
+			log.Errorf("calendar(%d) %v", c.ID, err)
+			continue
+		}
+		end := start
+		if v.End != "" {
+			if end, err = crontab.ParseDate(v.End); err != nil {
+				log.Errorf("calendar(%d) %v", c.ID, err)
+				continue
+			}
+		}
+		cal.Excludes = append(cal.Excludes, crontab.DateRange{
+			Name:  v.Name,
+			Start: start,
+			End:   end,
+		})
+	}
+	return cal
+}
@@ -0,0 +1,119 @@
+package jiacrontabd
+
+import (
+	"errors"
+	"jiacrontab/models"
+	"jiacrontab/pkg/crontab"
+	"jiacrontab/pkg/test"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func testCalendar(end string, updatedAt time.Time) models.Calendar {
+	c := models.Calendar{
+		Name:     "holiday",
+		Excludes: models.CalendarDates{{Start: "2020-10-01", End: end}},
+	}
+	c.ID = 1
+	c.UpdatedAt = updatedAt
+	return c
+}
+
+// waitRefresh 等待后台获取日历结束
+func waitRefresh(t *testing.T, c *calendars) {
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		c.mux.RLock()
+		n := len(c.refreshing)
+		c.mux.RUnlock()
+		if n == 0 {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("refresh blocked")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func excludeEnd(list []*crontab.Calendar, err error) string {
+	if err != nil || len(list) != 1 || len(list[0].Excludes) != 1 {
+		return ""
+	}
+	return list[0].Excludes[0].End.String()
+}
+
+func TestCalendars_Get(t *testing.T) {
+	j, admin := newTestEntry(t, models.CrontabJob{})
+	c := j.jd.calendars
+	now := time.Now()
+	admin.calendars = []models.Calendar{testCalendar("2020-10-08", now)}
+
+	// 没有缓存时使用下发的日历,后台获取admin中的日历
+	pushed := []models.Calendar{testCalendar("2020-10-07", now.Add(-time.Hour))}
+	test.Equal(t, "2020-10-07", excludeEnd(c.get([]uint{1}, pushed)))
+	waitRefresh(t, c)
+	test.Equal(t, "2020-10-08", excludeEnd(c.get([]uint{1}, pushed)))
+
+	// 下发的日历较新时优先使用
+	pushed = []models.Calendar{testCalendar("2020-10-09", now.Add(time.Hour))}
+	test.Equal(t, "2020-10-09", excludeEnd(c.get([]uint{1}, pushed)))
+
+	// admin不可用时保留上次获取的日历
+	admin.mux.Lock()
+	admin.calErr = errors.New("admin unavailable")
+	admin.mux.Unlock()
+	c.mux.Lock()
+	c.items[1].updatedAt = time.Time{}
+	c.mux.Unlock()
+	test.Equal(t, "2020-10-08", excludeEnd(c.get([]uint{1}, nil)))
+	waitRefresh(t, c)
+	test.Equal(t, "2020-10-08", excludeEnd(c.get([]uint{1}, nil)))
+}
+
+func TestCalendars_Missing(t *testing.T) {
+	test.Nil(t, models.CreateDB("sqlite3", filepath.Join(t.TempDir(), "node.db")))
+	test.Nil(t, models.DB().AutoMigrate(&models.CrontabJob{}))
+	job := models.CrontabJob{
+		Name:      "backup",
+		Status:    models.StatusJobTiming,
+		CronExpr:  "0 0 3 * * *",
+		Calendars: models.UintSlice{1},
+	}
+	test.Nil(t, models.DB().Create(&job).Error)
+
+	j, admin := newTestEntry(t, job)
+	c := j.jd.calendars
+	admin.calErr = errors.New("admin unavailable")
+
+	// 从未获取到的日历返回错误,job暂停调度
+	j.jd.scheduleRecovered(job)
+	test.Equal(t, false, j.jd.crontab.HasJob(job.ID))
+	waitRefresh(t, c)
+	_, err := c.get([]uint{1}, nil)
+	test.NotNil(t, err)
+	waitRefresh(t, c)
+
+	// 获取到日历后重新调度
+	admin.mux.Lock()
+	admin.calErr = nil
+	admin.calendars = []models.Calendar{testCalendar("2020-10-08", time.Now())}
+	admin.mux.Unlock()
+	j.jd.schedulePending()
+	deadline := time.Now().Add(5 * time.Second)
+	for !j.jd.crontab.HasJob(job.ID) {
+		if time.Now().After(deadline) {
+			t.Fatal("pending job was not scheduled")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// admin中已删除的日历不再生效
+	list, err := c.get([]uint{1, 2}, nil)
+	test.NotNil(t, err)
+	waitRefresh(t, c)
+	list, err = c.get([]uint{1, 2}, nil)
+	test.Nil(t, err)
+	test.Equal(t, 1, len(list))
+}
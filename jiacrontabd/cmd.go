@@ -1,18 +1,18 @@
 package jiacrontabd
 
 import (
-	"bufio"
-	"bytes"
 	"context"
 	"errors"
 	"fmt"
 	"io"
+	"jiacrontab/models"
 	"jiacrontab/pkg/kproc"
 	"jiacrontab/pkg/proto"
 	"jiacrontab/pkg/util"
 	"os"
 	"path/filepath"
 	"runtime/debug"
+	"sync"
 	"time"
 
 	"github.com/iwannay/log"
@@ -39,9 +39,81 @@ type cmdUint struct {
 	costTime         time.Duration
 	jd               *Jiacrontabd
 	market           string
+	stderr           []byte      // stderr的最后maxStderrTail字节,用于判断重试条件
+	usage            kproc.Usage // 退出码、终止信号和资源使用
+	successRule      models.SuccessRule
+	checker          *successChecker
+	stopSignal       string        // 停止时发送给进程组的信号
+	gracePeriod      time.Duration // 发送停止信号后等待退出的时间
+	limits           models.ProcLimits
+	nice             int
+	ioClass          string
+	ioPriority       int
+	mux              sync.Mutex // 保护并发写入的输出
+	hasOutput        bool
+	maxOutputSize    int          // 保存在content中的输出上限,单位KB,为0时使用节点的设置
+	maxLogSize       int          // 本次执行写入日志文件的上限,单位KB,为0时使用节点的设置
+	captured         cappedOutput // 执行过程中的content
+	logSize          int64        // 本次执行已写入日志文件的字节数
+	logDropped       int64        // 超出日志文件上限未写入的字节数
+}
+
+// sizeLimit job未设置时使用节点的设置,单位KB,返回字节数
+func sizeLimit(job, node int) int64 {
+	if job > 0 {
+		return int64(job) << 10
+	}
+	if node > 0 {
+		return int64(node) << 10
+	}
+	return 0
+}
+
+// maxStderrTail cmdUint保留的stderr长度
+const maxStderrTail = 64 << 10
+
+// appendStderr 保留stderr的最后maxStderrTail字节
+func (cu *cmdUint) appendStderr(line []byte) {
+	cu.stderr = append(cu.stderr, line...)
+	if n := len(cu.stderr) - maxStderrTail; n > 0 {
+		cu.stderr = append(cu.stderr[:0], cu.stderr[n:]...)
+	}
+}
+
+// setStop 设置停止信号、宽限时间、资源限制和优先级
+func (cu *cmdUint) setStop(cmd *kproc.KCmd) {
+	sig, err := kproc.ParseSignal(cu.stopSignal)
+	if err != nil {
+		log.Error("setStop error:", err)
+	} else {
+		cmd.SetStopSignal(sig)
+	}
+	cmd.SetGracePeriod(cu.gracePeriod)
+	cmd.SetLimits(kproc.Limits{
+		AddressSpace: cu.limits.AddressSpace << 20,
+		OpenFiles:    cu.limits.OpenFiles,
+		Processes:    cu.limits.Processes,
+		Cgroup:       cu.jd.getOpts().CgroupRoot,
+		Memory:       cu.limits.Memory << 20,
+		CPU:          cu.limits.CPU,
+		Pids:         cu.limits.Pids,
+	})
+	cmd.SetNice(cu.nice)
+	switch cu.ioClass {
+	case models.IOClassRealtime:
+		cmd.SetIOPriority(kproc.IOClassRealtime, cu.ioPriority)
+	case models.IOClassBestEffort:
+		cmd.SetIOPriority(kproc.IOClassBestEffort, cu.ioPriority)
+	case models.IOClassIdle:
+		cmd.SetIOPriority(kproc.IOClassIdle, 0)
+	}
 }
 
 func (cu *cmdUint) release() {
+	cu.content = cu.captured.Bytes()
+	if cu.logDropped > 0 && cu.logFile != nil {
+		cu.logFile.Write([]byte(truncatedMarker(cu.logDropped)))
+	}
 	if cu.logFile != nil {
 		cu.logFile.Close()
 	}
@@ -58,6 +130,9 @@ func (cu *cmdUint) launch() error {
 	}()
 	cfg := cu.jd.getOpts()
 	cu.startTime = time.Now()
+	cu.checker = newSuccessChecker(cu.successRule)
+	cu.captured = cappedOutput{limit: int(sizeLimit(cu.maxOutputSize, cfg.MaxOutputSize))}
+	cu.captured.Write(cu.content)
 
 	var err error
 
@@ -70,6 +145,17 @@ func (cu *cmdUint) launch() error {
 	} else {
 		err = cu.exec()
 	}
+	if cu.usage.Stop != "" {
+		// 被停止的执行不再按成功规则判断,即使进程收到信号后正常退出
+		if err == nil {
+			err = fmt.Errorf("stopped (%s)", cu.usage.Stop)
+		}
+	} else {
+		err = cu.checker.check(err, cu.usage.ExitCode, time.Since(cu.startTime))
+	}
+	if cu.usage.OOMKilled && err != nil {
+		err = fmt.Errorf("OOM killed: %v", err)
+	}
 
 	if err != nil {
 		var errMsg string
@@ -82,10 +168,9 @@ func (cu *cmdUint) launch() error {
 			errMsg = prefix + err.Error() + "\n"
 		}
 
-		cu.writeLog([]byte(errMsg))
-		if cu.exportLog {
-			cu.content = append(cu.content, []byte(errMsg)...)
-		}
+		cu.mux.Lock()
+		cu.writeLine(models.StreamSystem, []byte(errMsg))
+		cu.mux.Unlock()
 
 		return err
 	}
@@ -114,6 +199,12 @@ func (cu *cmdUint) writeLog(b []byte) {
 	if cu.ignoreFileLog {
 		return
 	}
+	// 超出上限后只保留日志文件的开头,结束时写入截断的字节数
+	if max := sizeLimit(cu.maxLogSize, cu.jd.getOpts().MaxRunLogSize); max > 0 && cu.logSize+int64(len(b)) > max {
+		cu.logDropped += int64(len(b))
+		return
+	}
+	cu.logSize += int64(len(b))
 	var err error
 	logPath := filepath.Join(cu.logDir, time.Now().Format("2006/01/02"), fmt.Sprintf("%d.log", cu.id))
 	if logPath != cu.logPath {
@@ -130,9 +221,6 @@ func (cu *cmdUint) writeLog(b []byte) {
 }
 
 func (cu *cmdUint) exec() error {
-	//market := cu.jd.jobs[cu.id].job.Market
-	market := cu.market
-
 	log.Debug("cmd exec args:", cu.args)
 	if len(cu.args) == 0 {
 		return errors.New("invalid args")
@@ -142,128 +230,104 @@ func (cu *cmdUint) exec() error {
 	cmdName := cu.args[0][0]
 	args := cu.args[0][1:]
 	cmd := kproc.CommandContext(cu.ctx, cmdName, args...)
-	cfg := cu.jd.getOpts()
+	defer func() {
+		cu.usage = cmd.Usage()
+	}()
 
 	cmd.SetDir(cu.dir)
 	cmd.SetEnv(cu.env)
 	cmd.SetUser(cu.user)
 	cmd.SetExitKillChildProcess(cu.killChildProcess)
+	cu.setStop(cmd)
 
-	stdout, err := cmd.StdoutPipe()
+	// 使用os.Pipe而不是StdoutPipe,Wait不会关闭读端,进程退出后仍可读完管道中的输出
+	stdout, stdoutW, err := os.Pipe()
 	if err != nil {
 		return err
 	}
 	defer stdout.Close()
 
-	stderr, err := cmd.StderrPipe()
+	stderr, stderrW, err := os.Pipe()
 	if err != nil {
+		stdoutW.Close()
 		return err
 	}
 	defer stderr.Close()
 
-	if err := cmd.Start(); err != nil {
+	cmd.Stdout = stdoutW
+	cmd.Stderr = stderrW
+	err = cmd.Start()
+	stdoutW.Close()
+	stderrW.Close()
+	if err != nil {
 		return err
 	}
 
-	reader := bufio.NewReader(stdout)
-	readerErr := bufio.NewReader(stderr)
-
-	// 新增：跟踪是否有输出
-	hasOutput := false
-
 	// 如果已经存在日志则直接写入
 	cu.writeLog(cu.content)
 
+	// 同时读取stdout和stderr,避免进程写满其中一个管道时阻塞
+	var wg sync.WaitGroup
+	wg.Add(2)
 	go func() {
-		var line []byte
-
-		// 处理标准输出
-		for {
-			line, _ = reader.ReadBytes('\n')
-			if len(line) == 0 {
-				break
-			}
-
-			hasOutput = true // 标记有输出
-			if len(market) > 0 {
-				line = append([]byte("["+market+"]"), line...)
-			}
-			if !bytes.HasSuffix(line, []byte{'\n'}) {
-				line = append(line, '\n')
-			}
-
-			if cfg.VerboseJobLog {
-				prefix := fmt.Sprintf("[%s %s %s] ", time.Now().Format(proto.DefaultTimeLayout), cfg.BoardcastAddr, cu.label)
-				line = append([]byte(prefix), line...)
-			}
-
-			if cu.exportLog {
-				cu.content = append(cu.content, line...)
-			}
-			cu.writeLog(line)
-		}
-
-		// 处理标准错误
-		for {
-			line, _ = readerErr.ReadBytes('\n')
-			if len(line) == 0 {
-				break
-			}
-
-			hasOutput = true // 标记有输出
-			if len(market) > 0 {
-				line = append([]byte("["+market+"]"), line...)
-			}
-			if !bytes.HasSuffix(line, []byte{'\n'}) {
-				line = append(line, '\n')
-			}
+		defer wg.Done()
+		cu.readStream(models.StreamStdout, stdout)
+	}()
+	go func() {
+		defer wg.Done()
+		cu.readStream(models.StreamStderr, stderr)
+	}()
 
-			if cfg.VerboseJobLog {
-				prefix := fmt.Sprintf("[%s %s %s] ", time.Now().Format(proto.DefaultTimeLayout), cfg.BoardcastAddr, cu.label)
-				line = append([]byte(prefix), line...)
-			}
+	err = cmd.Wait()
+	cu.drain(&wg, stdout, stderr)
+	cu.outputDone()
+	return err
+}
 
-			if cu.exportLog {
-				cu.content = append(cu.content, line...)
-			}
-			cu.writeLog(line)
+// drain 等待读完输出,超时后关闭管道结束读取
+func (cu *cmdUint) drain(wg *sync.WaitGroup, pipes ...io.Closer) {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(outputDrainTimeout):
+		for _, v := range pipes {
+			v.Close()
 		}
+		<-done
+	}
+}
 
-		// 如果没有输出，记录执行成功
-		if !hasOutput {
-
-			successMsg := []byte("[系统默认] 命令执行完成，无输出内容\n")
-			if len(market) > 0 {
-				successMsg = append([]byte("["+market+"]"), successMsg...)
-			}
-
-			if cfg.VerboseJobLog {
-				prefix := fmt.Sprintf("[%s %s %s] ", time.Now().Format(proto.DefaultTimeLayout), cfg.BoardcastAddr, cu.label)
-				successMsg = append([]byte(prefix), successMsg...)
-			}
-
-			if cu.exportLog {
-				cu.content = append(cu.content, successMsg...)
-			}
-			cu.writeLog(successMsg)
-		}
-	}()
+// outputDone 没有输出时记录执行完成
+func (cu *cmdUint) outputDone() {
+	cu.mux.Lock()
+	defer cu.mux.Unlock()
+	if cu.hasOutput {
+		return
+	}
 
-	if err = cmd.Wait(); err != nil {
-		return err
+	cfg := cu.jd.getOpts()
+	successMsg := []byte("[系统默认] 命令执行完成，无输出内容\n")
+	if len(cu.market) > 0 {
+		successMsg = append([]byte("["+cu.market+"]"), successMsg...)
 	}
 
-	return nil
+	if cfg.VerboseJobLog {
+		prefix := fmt.Sprintf("[%s %s %s] ", time.Now().Format(proto.DefaultTimeLayout), cfg.BoardcastAddr, cu.label)
+		successMsg = append([]byte(prefix), successMsg...)
+	}
+	cu.writeLine(models.StreamSystem, successMsg)
 }
 
 func (cu *cmdUint) pipeExec() error {
 	var (
-		outBufer       bytes.Buffer
-		errBufer       bytes.Buffer
-		cmdEntryList   []*pipeCmd
-		err, exitError error
-		line           []byte
-		cfg            = cu.jd.getOpts()
+		cmdEntryList []*pipeCmd
+		stderrList   []*lineWriter
+		exitError    error
+		stdout       = &lineWriter{cu: cu, stream: models.StreamStdout}
 	)
 
 	for _, v := range cu.args {
@@ -277,48 +341,26 @@ func (cu *cmdUint) pipeExec() error {
 		cmd.SetEnv(cu.env)
 		cmd.SetUser(cu.user)
 		cmd.SetExitKillChildProcess(cu.killChildProcess)
+		cu.setStop(cmd)
 
 		cmdEntryList = append(cmdEntryList, &pipeCmd{cmd})
+		// 各进程的stderr由exec各自的goroutine写入,分别使用lineWriter
+		stderrList = append(stderrList, &lineWriter{cu: cu, stream: models.StreamStderr})
 	}
 
-	exitError = execute(&outBufer, &errBufer,
-		cmdEntryList...,
-	)
-
 	// 如果已经存在日志则直接写入
 	cu.writeLog(cu.content)
 
-	for {
-
-		line, err = outBufer.ReadBytes('\n')
-		if err != nil || err == io.EOF {
-			break
-		}
-		if cfg.VerboseJobLog {
-			prefix := fmt.Sprintf("[%s %s %s] ", time.Now().Format(proto.DefaultTimeLayout), cfg.BoardcastAddr, cu.label)
-			line = append([]byte(prefix), line...)
-		}
-
-		cu.content = append(cu.content, line...)
-		cu.writeLog(line)
+	exitError = execute(stdout, stderrList, cmdEntryList...)
+	for _, v := range cmdEntryList {
+		cu.usage.Add(v.Usage())
 	}
 
-	for {
-		line, err = errBufer.ReadBytes('\n')
-		if err != nil || err == io.EOF {
-			break
-		}
-
-		if cfg.VerboseJobLog {
-			prefix := fmt.Sprintf("[%s %s %s] ", time.Now().Format(proto.DefaultTimeLayout), cfg.BoardcastAddr, cu.label)
-			line = append([]byte(prefix), line...)
-		}
-
-		if cu.exportLog {
-			cu.content = append(cu.content, line...)
-		}
-		cu.writeLog(line)
+	stdout.flush()
+	for _, v := range stderrList {
+		v.flush()
 	}
+	cu.outputDone()
 	return exitError
 }
 
@@ -352,22 +394,22 @@ type pipeCmd struct {
 	*kproc.KCmd
 }
 
-func execute(outputBuffer *bytes.Buffer, errorBuffer *bytes.Buffer, stack ...*pipeCmd) (err error) {
+func execute(outputWriter io.Writer, errorWriters []*lineWriter, stack ...*pipeCmd) (err error) {
 	pipeStack := make([]*io.PipeWriter, len(stack)-1)
 	i := 0
 	for ; i < len(stack)-1; i++ {
 		stdinPipe, stdoutPipe := io.Pipe()
 		stack[i].Stdout = stdoutPipe
-		stack[i].Stderr = errorBuffer
+		stack[i].Stderr = errorWriters[i]
 		stack[i+1].Stdin = stdinPipe
 		pipeStack[i] = stdoutPipe
 	}
 
-	stack[i].Stdout = outputBuffer
-	stack[i].Stderr = errorBuffer
+	stack[i].Stdout = outputWriter
+	stack[i].Stderr = errorWriters[i]
 
 	if err = call(stack, pipeStack); err != nil {
-		errorBuffer.WriteString(err.Error())
+		errorWriters[i].Write([]byte(err.Error()))
 	}
 	return err
 }
@@ -0,0 +1,145 @@
+package jiacrontabd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"jiacrontab/models"
+	"jiacrontab/pkg/proto"
+	"jiacrontab/pkg/test"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestHelperProcess 测试用的假进程,由newTestCmd启动
+func TestHelperProcess(t *testing.T) {
+	if os.Getenv("GO_WANT_HELPER_PROCESS") != "1" {
+		return
+	}
+	defer os.Exit(0)
+
+	switch os.Args[len(os.Args)-1] {
+	case "interleave":
+		for i := 0; i < 3; i++ {
+			fmt.Fprintf(os.Stdout, "out %d\n", i)
+			fmt.Fprintf(os.Stderr, "err %d\n", i)
+		}
+	case "flood":
+		// 超过管道缓冲区大小的stderr输出
+		line := strings.Repeat("e", 1023) + "\n"
+		for i := 0; i < 1024; i++ {
+			os.Stderr.WriteString(line)
+		}
+		fmt.Fprint(os.Stdout, "done")
+	case "nonewline":
+		os.Stdout.WriteString(strings.Repeat("x", 3*maxLineSize+10))
+	case "silent":
+	}
+}
+
+func newTestCmd(t *testing.T, mode string) *cmdUint {
+	cfg := NewConfig()
+	cfg.LogPath = t.TempDir()
+	cfg.VerboseJobLog = false
+	return &cmdUint{
+		ctx:       context.Background(),
+		id:        1,
+		args:      [][]string{{os.Args[0], "-test.run=TestHelperProcess", "--", mode}},
+		env:       []string{"GO_WANT_HELPER_PROCESS=1"},
+		logDir:    filepath.Join(cfg.LogPath, "crontab_task"),
+		label:     "test",
+		exportLog: true,
+		jd:        New(cfg),
+	}
+}
+
+// lines 去掉输出流标记中的时间
+func lines(content []byte) []string {
+	var ret []string
+	for _, v := range strings.Split(strings.TrimSpace(string(content)), "\n") {
+		if i := strings.Index(v, " "); i > 0 {
+			if j := strings.Index(v, "] "); j > i {
+				v = v[:i] + v[j:]
+			}
+		}
+		ret = append(ret, v)
+	}
+	return ret
+}
+
+func TestCmdUint_Interleave(t *testing.T) {
+	cu := newTestCmd(t, "interleave")
+	test.Nil(t, cu.launch())
+	// 两个输出流分别读取,只比较各自的顺序
+	var stdout, stderr []string
+	for _, v := range lines(cu.content) {
+		switch {
+		case strings.HasPrefix(v, "[stdout] "):
+			stdout = append(stdout, v)
+		case strings.HasPrefix(v, "[stderr] "):
+			stderr = append(stderr, v)
+		}
+	}
+	test.Equal(t, []string{"[stdout] out 0", "[stdout] out 1", "[stdout] out 2"}, stdout)
+	test.Equal(t, []string{"[stderr] err 0", "[stderr] err 1", "[stderr] err 2"}, stderr)
+	test.Equal(t, "err 0\nerr 1\nerr 2\n", string(cu.stderr))
+
+	// 按输出流查找日志
+	var reply proto.SearchLogResult
+	test.Nil(t, newCrontabJobSrv(cu.jd).Log(proto.SearchLog{
+		JobID:    1,
+		Pagesize: 10,
+		Stream:   models.StreamStderr,
+	}, &reply))
+	test.Equal(t, []string{
+		"[stderr] err 0",
+		"[stderr] err 1",
+		"[stderr] err 2",
+	}, lines(reply.Content))
+}
+
+func TestCmdUint_StderrFlood(t *testing.T) {
+	cu := newTestCmd(t, "flood")
+	cu.jd.getOpts().MaxOutputSize = 0
+	done := make(chan error, 1)
+	go func() {
+		done <- cu.launch()
+	}()
+
+	select {
+	case err := <-done:
+		test.Nil(t, err)
+	case <-time.After(10 * time.Second):
+		t.Fatal("launch blocked by stderr")
+	}
+
+	l := lines(cu.content)
+	test.Equal(t, 1025, len(l))
+	// 两个输出流之间没有先后顺序
+	test.Equal(t, true, strings.Contains(string(cu.content), "] done\n"))
+	test.Equal(t, maxStderrTail, len(cu.stderr))
+}
+
+func TestCmdUint_NoOutput(t *testing.T) {
+	cu := newTestCmd(t, "silent")
+	test.Nil(t, cu.launch())
+	test.Equal(t, true, bytes.HasPrefix(cu.content, []byte("[system ")))
+}
+
+func TestCmdUint_NoNewline(t *testing.T) {
+	cu := newTestCmd(t, "nonewline")
+	cu.jd.getOpts().MaxOutputSize = 0
+	test.Nil(t, cu.launch())
+
+	// 不换行的输出按maxLineSize拆分,不会一直缓存
+	var size []int
+	for _, v := range lines(cu.content) {
+		if strings.HasPrefix(v, "[stdout] ") {
+			size = append(size, len(v)-len("[stdout] "))
+		}
+	}
+	test.Equal(t, []int{maxLineSize, maxLineSize, maxLineSize, 10}, size)
+}
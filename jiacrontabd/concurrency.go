@@ -0,0 +1,224 @@
+package jiacrontabd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"jiacrontab/models"
+	"jiacrontab/pkg/proto"
+	"sync/atomic"
+	"time"
+
+	"github.com/iwannay/log"
+)
+
+var errReplaced = errors.New("replaced by a new run")
+
+// queuedRun 排队等待的执行
+type queuedRun struct {
+	enqueueTime time.Time
+}
+
+// acquire 按job的并发策略取得执行资格,返回false时放弃本次执行
+// 只执行一次的job不参与排队和替换,达到最大并发数时直接丢弃
+func (j *JobEntry) acquire(now time.Time) bool {
+	max := int32(j.detail.MaxConcurrent)
+
+	j.mux.Lock()
+	if max == 0 || atomic.LoadInt32(&j.processNum) < max {
+		atomic.AddInt32(&j.processNum, 1)
+		j.mux.Unlock()
+		return true
+	}
+
+	policy := j.detail.ConcurrencyPolicy
+	if j.once && (policy == models.ConcurrencyQueue || policy == models.ConcurrencyReplace) {
+		policy = models.ConcurrencyDrop
+	}
+
+	switch policy {
+	case models.ConcurrencyQueue:
+		maxQueued := j.detail.MaxQueued
+		if maxQueued <= 0 {
+			maxQueued = models.DefaultMaxQueued
+		}
+		if len(j.queue) >= maxQueued {
+			j.mux.Unlock()
+			j.reject(now, exitDropped, fmt.Sprintf("排队数量已达上限%d,丢弃本次执行", maxQueued))
+			return false
+		}
+		run := &queuedRun{enqueueTime: now}
+		j.queue = append(j.queue, run)
+		// 按入队顺序执行
+		for atomic.LoadInt32(&j.stop) == 0 && (j.queue[0] != run || atomic.LoadInt32(&j.processNum) >= max) {
+			j.released.Wait()
+		}
+		j.dequeue(run)
+		if atomic.LoadInt32(&j.stop) == 1 {
+			j.mux.Unlock()
+			return false
+		}
+		atomic.AddInt32(&j.processNum, 1)
+		j.released.Broadcast()
+		j.mux.Unlock()
+		return true
+
+	case models.ConcurrencyReplace:
+		for _, p := range j.processes {
+			atomic.StoreInt32(&p.replaced, 1)
+			p.cancel()
+		}
+		for atomic.LoadInt32(&j.stop) == 0 && atomic.LoadInt32(&j.processNum) >= max {
+			j.released.Wait()
+		}
+		if atomic.LoadInt32(&j.stop) == 1 {
+			j.mux.Unlock()
+			return false
+		}
+		atomic.AddInt32(&j.processNum, 1)
+		j.mux.Unlock()
+		return true
+
+	case models.ConcurrencySkipAlert:
+		j.mux.Unlock()
+		msg := "已达到最大并发数,跳过本次执行"
+		j.reject(now, exitSkipped, msg)
+		j.alertSkipped(now, msg)
+		return false
+
+	default:
+		j.mux.Unlock()
+		j.reject(now, exitDropped, "不得超过job最大并发数量")
+		return false
+	}
+}
+
+// release 执行结束后释放执行资格并唤醒排队的执行
+func (j *JobEntry) release() {
+	j.mux.Lock()
+	atomic.AddInt32(&j.processNum, -1)
+	j.released.Broadcast()
+	j.mux.Unlock()
+}
+
+// dequeue 调用方需持有j.mux
+func (j *JobEntry) dequeue(run *queuedRun) {
+	for k, v := range j.queue {
+		if v == run {
+			j.queue = append(j.queue[:k], j.queue[k+1:]...)
+			return
+		}
+	}
+}
+
+// queued 排队等待的执行的入队时间
+func (j *JobEntry) queued() []time.Time {
+	j.mux.RLock()
+	defer j.mux.RUnlock()
+	var ret []time.Time
+	for _, v := range j.queue {
+		ret = append(ret, v.enqueueTime)
+	}
+	return ret
+}
+
+// reject 记录未执行的调度
+func (j *JobEntry) reject(now time.Time, exitStatus, msg string) {
+	j.logContent = []byte(msg + "\n")
+	log.Infof("%s(%d) %s", j.detail.Name, j.detail.ID, msg)
+	if err := j.jd.rpcCallCtx(context.TODO(), "Srv.PushJobLog", models.JobHistory{
+		JobType:    models.JobTypeCrontab,
+		JobID:      j.detail.ID,
+		Addr:       j.jd.getOpts().BoardcastAddr,
+		JobName:    j.detail.Name,
+		StartTime:  now,
+		EndTime:    now,
+		ExitMsg:    msg,
+		ExitStatus: exitStatus,
+
+		Misfire:       !j.misfire.IsZero(),
+		ScheduledTime: j.misfire,
+	}, nil); err != nil {
+		log.Error("rpc call Srv.PushJobLog failed:", err)
+	}
+}
+
+// exitStatus 执行结果
+func (j *JobEntry) exitStatus(p *process, err error) string {
+	switch {
+	case err == nil:
+		return exitSuccess
+	case errors.Is(err, errReplaced):
+		return exitReplaced
+	case p.usage.OOMKilled:
+		return exitOOMKilled
+	case atomic.LoadInt32(&p.timedOut) == 1:
+		return exitTimeout
+	default:
+		return exitError
+	}
+}
+
+// alertSkipped 按job的告警设置发送跳过执行的告警
+func (j *JobEntry) alertSkipped(now time.Time, msg string) {
+	var (
+		err   error
+		reply bool
+		cfg   = j.jd.getOpts()
+	)
+
+	if j.detail.ErrorMailNotify {
+		if err = j.jd.rpcCallCtx(context.TODO(), "Srv.SendMail", proto.SendMail{
+			MailTo:  j.detail.MailTo,
+			Subject: cfg.BoardcastAddr + "提醒脚本跳过执行",
+			Content: fmt.Sprintf(
+				"任务名：%s<br/>创建者：%s<br/>调度时间：%s<br/>原因：%s",
+				j.detail.Name, j.detail.CreatedUsername, now.Format(proto.DefaultTimeLayout), msg),
+		}, &reply); err != nil {
+			log.Error("Srv.SendMail error:", err, "server addr:", cfg.AdminAddr)
+		}
+	}
+
+	if j.detail.ErrorAPINotify {
+		postData, err := json.Marshal(proto.CrontabApiNotifyBody{
+			NodeAddr:       cfg.BoardcastAddr,
+			JobName:        j.detail.Name,
+			JobID:          int(j.detail.ID),
+			CreateUsername: j.detail.CreatedUsername,
+			CreatedAt:      j.detail.CreatedAt,
+			Timeout:        int64(j.detail.Timeout),
+			Type:           "skipped",
+		})
+		if err != nil {
+			log.Error("json.Marshal error:", err)
+			return
+		}
+		if err = j.jd.rpcCallCtx(context.TODO(), "Srv.ApiPost", proto.ApiPost{
+			Urls: j.detail.APITo,
+			Data: string(postData),
+		}, &reply); err != nil {
+			log.Error("Srv.ApiPost error:", err, "server addr:", cfg.AdminAddr)
+		}
+	}
+
+	if j.detail.ErrorDingdingNotify {
+		nodeAddr := cfg.BoardcastAddr
+		title := nodeAddr + "告警：脚本跳过执行"
+		notifyContent := fmt.Sprintf("> ###### 来自jiacrontabd: %s 的脚本跳过执行报警：\n> ##### 任务id：%d\n> ##### 任务名称：%s\n> ##### 原因：%s\n> ##### 报警时间：%s", nodeAddr, int(j.detail.ID), j.detail.Name, msg, now.Format("2006-01-02 15:04:05"))
+		notifyBody := fmt.Sprintf(
+			`{
+				"msgtype": "markdown",
+				"markdown": {
+					"title": "%s",
+					"text": "%s"
+				}
+			}`, title, notifyContent)
+		if err = j.jd.rpcCallCtx(context.TODO(), "Srv.ApiPost", proto.ApiPost{
+			Urls: j.detail.DingdingTo,
+			Data: notifyBody,
+		}, &reply); err != nil {
+			log.Error("Srv.ApiPost error:", err, "server addr:", cfg.AdminAddr)
+		}
+	}
+}
@@ -0,0 +1,233 @@
+package jiacrontabd
+
+import (
+	"context"
+	"jiacrontab/models"
+	"jiacrontab/pkg/crontab"
+	"jiacrontab/pkg/proto"
+	"jiacrontab/pkg/test"
+	"net"
+	"net/rpc"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeAdmin 记录jiacrontabd对admin的rpc调用
+type fakeAdmin struct {
+	mux       sync.Mutex
+	histories []models.JobHistory
+	mails     []proto.SendMail
+	calendars []models.Calendar
+	calErr    error
+	acquires  int
+	releases  int
+}
+
+func (a *fakeAdmin) Ping(args *proto.EmptyArgs, reply *proto.EmptyReply) error {
+	return nil
+}
+
+func (a *fakeAdmin) PushJobLog(args models.JobHistory, reply *bool) error {
+	a.mux.Lock()
+	a.histories = append(a.histories, args)
+	a.mux.Unlock()
+	return nil
+}
+
+func (a *fakeAdmin) SendMail(args proto.SendMail, reply *bool) error {
+	a.mux.Lock()
+	a.mails = append(a.mails, args)
+	a.mux.Unlock()
+	return nil
+}
+
+func (a *fakeAdmin) ApiPost(args proto.ApiPost, reply *bool) error {
+	return nil
+}
+
+func (a *fakeAdmin) GetCalendars(args proto.GetCalendarsArgs, reply *[]models.Calendar) error {
+	a.mux.Lock()
+	defer a.mux.Unlock()
+	if a.calErr != nil {
+		return a.calErr
+	}
+	*reply = a.calendars
+	return nil
+}
+
+func (a *fakeAdmin) exitStatus() []string {
+	a.mux.Lock()
+	defer a.mux.Unlock()
+	var ret []string
+	for _, v := range a.histories {
+		ret = append(ret, v.ExitStatus)
+	}
+	return ret
+}
+
+// newTestEntry 创建连接到fakeAdmin的JobEntry
+func newTestEntry(t *testing.T, detail models.CrontabJob) (*JobEntry, *fakeAdmin) {
+	admin := &fakeAdmin{}
+	srv := rpc.NewServer()
+	test.Nil(t, srv.RegisterName("Srv", admin))
+	l, err := net.Listen("tcp4", "127.0.0.1:0")
+	test.Nil(t, err)
+	go srv.Accept(l)
+	t.Cleanup(func() { l.Close() })
+
+	cfg := NewConfig()
+	cfg.AdminAddr = l.Addr().String()
+	j := newJobEntry(&crontab.Job{ID: 1}, New(cfg))
+	j.detail = detail
+	return j, admin
+}
+
+// acquireAsync 在goroutine中取得执行资格
+func acquireAsync(j *JobEntry) chan bool {
+	ch := make(chan bool, 1)
+	go func() {
+		ch <- j.acquire(time.Now())
+	}()
+	return ch
+}
+
+// waitQueue 等待排队的执行数达到n
+func waitQueue(t *testing.T, j *JobEntry, n int) {
+	deadline := time.Now().Add(5 * time.Second)
+	for len(j.queued()) != n {
+		if time.Now().After(deadline) {
+			t.Fatalf("queued %d, want %d", len(j.queued()), n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func receive(t *testing.T, ch chan bool) bool {
+	select {
+	case v := <-ch:
+		return v
+	case <-time.After(5 * time.Second):
+		t.Fatal("acquire blocked")
+		return false
+	}
+}
+
+func blocked(ch chan bool) bool {
+	select {
+	case <-ch:
+		return false
+	case <-time.After(50 * time.Millisecond):
+		return true
+	}
+}
+
+func TestJobEntry_AcquireDrop(t *testing.T) {
+	j, admin := newTestEntry(t, models.CrontabJob{MaxConcurrent: 1})
+	test.Equal(t, true, j.acquire(time.Now()))
+	test.Equal(t, false, j.acquire(time.Now()))
+	test.Equal(t, []string{exitDropped}, admin.exitStatus())
+
+	j.release()
+	test.Equal(t, true, j.acquire(time.Now()))
+	test.Equal(t, int32(1), atomic.LoadInt32(&j.processNum))
+}
+
+func TestJobEntry_AcquireSkipAlert(t *testing.T) {
+	j, admin := newTestEntry(t, models.CrontabJob{
+		MaxConcurrent:     1,
+		ConcurrencyPolicy: models.ConcurrencySkipAlert,
+		ErrorMailNotify:   true,
+		MailTo:            []string{"a@example.com"},
+	})
+	test.Equal(t, true, j.acquire(time.Now()))
+	test.Equal(t, false, j.acquire(time.Now()))
+	test.Equal(t, []string{exitSkipped}, admin.exitStatus())
+	test.Equal(t, 1, len(admin.mails))
+}
+
+func TestJobEntry_AcquireQueue(t *testing.T) {
+	j, admin := newTestEntry(t, models.CrontabJob{
+		MaxConcurrent:     1,
+		ConcurrencyPolicy: models.ConcurrencyQueue,
+		MaxQueued:         2,
+	})
+	test.Equal(t, true, j.acquire(time.Now()))
+
+	first := acquireAsync(j)
+	waitQueue(t, j, 1)
+	second := acquireAsync(j)
+	waitQueue(t, j, 2)
+
+	// 排队已满时丢弃
+	test.Equal(t, false, j.acquire(time.Now()))
+	test.Equal(t, []string{exitDropped}, admin.exitStatus())
+
+	// 每次释放按入队顺序唤醒一个
+	test.Equal(t, true, blocked(first))
+	j.release()
+	test.Equal(t, true, receive(t, first))
+	test.Equal(t, true, blocked(second))
+	waitQueue(t, j, 1)
+	j.release()
+	test.Equal(t, true, receive(t, second))
+	waitQueue(t, j, 0)
+	test.Equal(t, int32(1), atomic.LoadInt32(&j.processNum))
+}
+
+func TestJobEntry_AcquireQueueStop(t *testing.T) {
+	j, _ := newTestEntry(t, models.CrontabJob{
+		MaxConcurrent:     1,
+		ConcurrencyPolicy: models.ConcurrencyQueue,
+	})
+	test.Equal(t, true, j.acquire(time.Now()))
+	queued := acquireAsync(j)
+	waitQueue(t, j, 1)
+
+	// 停止job时排队的执行放弃
+	j.exit()
+	test.Equal(t, false, receive(t, queued))
+	waitQueue(t, j, 0)
+	test.Equal(t, int32(1), atomic.LoadInt32(&j.processNum))
+}
+
+func TestJobEntry_AcquireReplace(t *testing.T) {
+	j, admin := newTestEntry(t, models.CrontabJob{
+		MaxConcurrent:     1,
+		ConcurrencyPolicy: models.ConcurrencyReplace,
+	})
+	test.Equal(t, true, j.acquire(time.Now()))
+	ctx, cancel := context.WithCancel(context.Background())
+	p := &process{ctx: ctx, cancel: cancel}
+	j.mux.Lock()
+	j.processes[1] = p
+	j.mux.Unlock()
+
+	// 结束正在执行的实例,等其释放后再执行
+	replacing := acquireAsync(j)
+	select {
+	case <-ctx.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("running process not canceled")
+	}
+	test.Equal(t, int32(1), atomic.LoadInt32(&p.replaced))
+	test.Equal(t, true, blocked(replacing))
+
+	j.release()
+	test.Equal(t, true, receive(t, replacing))
+	test.Equal(t, 0, len(admin.exitStatus()))
+}
+
+func TestJobEntry_AcquireOnce(t *testing.T) {
+	// 只执行一次的job不排队,直接丢弃
+	j, admin := newTestEntry(t, models.CrontabJob{
+		MaxConcurrent:     1,
+		ConcurrencyPolicy: models.ConcurrencyQueue,
+	})
+	j.setOnce(true)
+	test.Equal(t, true, j.acquire(time.Now()))
+	test.Equal(t, false, j.acquire(time.Now()))
+	test.Equal(t, []string{exitDropped}, admin.exitStatus())
+	test.Equal(t, 0, len(j.queued()))
+}
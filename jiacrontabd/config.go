@@ -1,6 +1,7 @@
 package jiacrontabd
 
 import (
+	"jiacrontab/pkg/crontab"
 	"jiacrontab/pkg/file"
 	"jiacrontab/pkg/util"
 	"net"
@@ -30,6 +31,11 @@ type Config struct {
 	iniFile             *ini.File
 	DriverName          string `opt:"driver_name"`
 	DSN                 string `opt:"dsn"`
+	ScheduleHorizon     int    `opt:"schedule_horizon"`
+	MaxConcurrentJobs   int    `opt:"max_concurrent_jobs"`
+	CgroupRoot          string `opt:"cgroup_root"`
+	MaxOutputSize       int    `opt:"max_output_size"`
+	MaxRunLogSize       int    `opt:"max_run_log_size"`
 }
 
 func (c *Config) Resolve() error {
@@ -90,6 +96,9 @@ func NewConfig() *Config {
 		DriverName:          "sqlite3",
 		DSN:                 "data/jiacrontabd.db",
 		ClientAliveInterval: 30,
+		ScheduleHorizon:     crontab.DefaultHorizon,
+		CgroupRoot:          "/sys/fs/cgroup/jiacrontab",
+		MaxOutputSize:       1024,
 	}
 }
 
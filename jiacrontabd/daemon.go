@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"jiacrontab/models"
 	"jiacrontab/pkg/proto"
+	"jiacrontab/pkg/util"
 	"path/filepath"
 	"strings"
 	"sync"
@@ -80,11 +81,27 @@ func (d *daemonJob) do(ctx context.Context) {
 			jd:     d.daemon.jd,
 			id:     d.job.ID,
 			logDir: filepath.Join(cfg.LogPath, "daemon_job"),
+
+			successRule: d.job.SuccessRule,
+			stopSignal:  d.job.StopSignal,
+			gracePeriod: time.Duration(d.job.StopGracePeriod) * time.Second,
+			limits:      d.job.Limits,
+			nice:        d.job.Nice,
+			ioClass:     d.job.IOClass,
+			ioPriority:  d.job.IOPriority,
+			maxLogSize:  d.job.MaxLogSize,
 		}
 
 		log.Info("exec daemon job, jobName:", d.job.Name, " jobID", d.job.ID)
 
+		// 启动进程前取得命名锁,进程退出后释放
+		locks, clusterLock := d.job.Locks, d.job.ClusterLock
+		lockHolder := fmt.Sprintf("daemon:%d:%s", d.job.ID, util.UUID())
+		if !d.daemon.jd.locks.lock(locks, lockHolder, clusterLock, func() bool { return ctx.Err() != nil }) {
+			break
+		}
 		err = myCmdUint.launch()
+		d.daemon.jd.locks.unlock(locks, lockHolder, clusterLock)
 		retryNum--
 		d.handleNotify(err)
 
@@ -90,7 +90,7 @@ func (d *dependencies) exec(task *depEntry) {
 
 	log.Infof("dep start exec %s->%v", task.name, task.commands)
 	task.err = myCmdUnit.launch()
-	task.logContent = bytes.TrimRight(myCmdUnit.content, "\x00")
+	task.logContent = stripStreamTags(bytes.TrimRight(myCmdUnit.content, "\x00"))
 	task.done = true
 	log.Infof("exec %s %s cost %.4fs %v", task.name, task.commands, float64(myCmdUnit.costTime)/1000000000, err)
 
@@ -25,8 +25,12 @@ type Jiacrontabd struct {
 	// All jobs added
 	jobs            map[uint]*JobEntry
 	tmpJobs         map[string]*JobEntry
+	oneOffs         map[uint]*crontab.Task
 	dep             *dependencies
 	daemon          *Daemon
+	calendars       *calendars
+	slots           *slots
+	locks           *lockGroups
 	heartbeatPeriod time.Duration
 	mux             sync.RWMutex
 	startTime       time.Time
@@ -39,6 +43,7 @@ func New(opt *Config) *Jiacrontabd {
 	j := &Jiacrontabd{
 		jobs:    make(map[uint]*JobEntry),
 		tmpJobs: make(map[string]*JobEntry),
+		oneOffs: make(map[uint]*crontab.Task),
 
 		heartbeatPeriod: 5 * time.Second,
 		crontab:         crontab.New(),
@@ -46,6 +51,9 @@ func New(opt *Config) *Jiacrontabd {
 	j.swapOpts(opt)
 	j.dep = newDependencies(j)
 	j.daemon = newDaemon(100, j)
+	j.calendars = newCalendars(j)
+	j.slots = newSlots(j)
+	j.locks = newLockGroups(j)
 
 	return j
 }
@@ -98,10 +106,35 @@ func (j *Jiacrontabd) addJob(job *crontab.Job, updateLastExecTime bool) error {
 	}
 	j.mux.Unlock()
 
-	if err := j.crontab.AddJob(job); err != nil {
+	if job.Horizon == 0 {
+		job.Horizon = j.getOpts().ScheduleHorizon
+	}
+
+	if err := j.crontab.UpdateJob(job); err != nil {
+		if crontab.IsFinished(err) {
+			log.Infof("jobID(%d) schedule finished: %v", job.ID, err)
+			if err := models.DB().Model(&models.CrontabJob{}).Where("id=?", job.ID).
+				Updates(map[string]interface{}{
+					"status":         finishedStatus(err),
+					"next_exec_time": time.Time{},
+				}).Error; err != nil {
+				log.Error(err)
+			}
+			if crontab.IsExpired(err) {
+				j.pubJobEvent(job.ID, proto.JobEvent_Expired)
+			}
+			return err
+		}
 		log.Error("NextExecutionTime:", err, " timeArgs:", job)
 		return fmt.Errorf("时间格式错误: %v - %s", err, job.Format())
 	}
+	skipped := newSkippedExecutions(job.GetSkipped())
+	j.mux.Lock()
+	if v, ok := j.jobs[job.ID]; ok {
+		v.skipped = skipped
+	}
+	j.mux.Unlock()
+
 	data := map[string]interface{}{
 		"next_exec_time": job.GetNextExecTime(),
 		"status":         models.StatusJobTiming,
@@ -119,6 +152,27 @@ func (j *Jiacrontabd) addJob(job *crontab.Job, updateLastExecTime bool) error {
 	return nil
 }
 
+// pubJobEvent 在admin中记录job的动态
+func (j *Jiacrontabd) pubJobEvent(jobID uint, event string) {
+	var (
+		job   models.CrontabJob
+		reply bool
+	)
+	if err := models.DB().Take(&job, "id=?", jobID).Error; err != nil {
+		log.Error(err)
+		return
+	}
+	if err := j.rpcCallCtx(context.TODO(), "Srv.PubJobEvent", proto.JobEventArgs{
+		Addr:    j.getOpts().BoardcastAddr,
+		GroupID: job.GroupID,
+		JobID:   job.ID,
+		JobName: job.Name,
+		Event:   event,
+	}, &reply); err != nil {
+		log.Error("rpc call Srv.PubJobEvent failed:", err)
+	}
+}
+
 func (j *Jiacrontabd) execTask(job *crontab.Job) {
 
 	j.mux.RLock()
@@ -157,8 +211,12 @@ func (j *Jiacrontabd) run() {
 	j.wg.Wrap(j.crontab.QueueScanWorker)
 
 	for v := range j.crontab.Ready() {
-		v := v.Value.(*crontab.Job)
-		j.execTask(v)
+		switch v := v.Value.(type) {
+		case *crontab.Job:
+			j.execTask(v)
+		case *models.OneOffRun:
+			go j.execOneOff(v)
+		}
 	}
 }
 
@@ -321,10 +379,12 @@ func (j *Jiacrontabd) count() int {
 	return num
 }
 
+// deleteJob 移除job并取消调度
 func (j *Jiacrontabd) deleteJob(jobID uint) {
 	j.mux.Lock()
 	delete(j.jobs, jobID)
 	j.mux.Unlock()
+	j.crontab.RemoveJob(jobID)
 }
 
 func (j *Jiacrontabd) heartBeat() {
@@ -418,9 +478,53 @@ func (j *Jiacrontabd) heartBeat() {
 		log.Error("Srv.Register error:", err, ",server addr:", cfg.AdminAddr)
 	}
 
+	// 重新获取暂停调度的job的排除日历
+	j.schedulePending()
+
 	time.AfterFunc(time.Duration(j.getOpts().ClientAliveInterval)*time.Second, j.heartBeat)
 }
 
+// scheduleRecovered 将重启前的job加入调度并处理错过的执行
+// 获取不到排除日历时暂停调度,获取到后再处理
+func (j *Jiacrontabd) scheduleRecovered(v models.CrontabJob) {
+	job, err := j.newCrontabJob(&v)
+	if err != nil {
+		log.Errorf("jobID(%d) recovery: %v", v.ID, err)
+		j.calendars.wait(v.ID, true)
+		return
+	}
+	missed, last := missedExecTimes(job, v.LastExecTime, v.NextExecTime, time.Now())
+	if err := j.addJob(job, false); crontab.IsFinished(err) {
+		j.deleteJob(v.ID)
+	}
+	go j.handleMisfire(v, missed, last)
+}
+
+// schedulePending 重新调度因获取不到排除日历暂停的job
+func (j *Jiacrontabd) schedulePending() {
+	for id, recovered := range j.calendars.takePending() {
+		var v models.CrontabJob
+		// 等待期间已停止或删除的job不再调度
+		if err := models.DB().Take(&v, "id=? and status in (?)", id,
+			[]models.JobStatus{models.StatusJobTiming, models.StatusJobRunning}).Error; err != nil {
+			log.Infof("jobID(%d) schedulePending: %v", id, err)
+			continue
+		}
+		if recovered {
+			j.scheduleRecovered(v)
+			continue
+		}
+		job, err := j.newCrontabJob(&v)
+		if err != nil {
+			j.calendars.wait(id, false)
+			continue
+		}
+		if err := j.addJob(job, false); crontab.IsFinished(err) {
+			j.deleteJob(id)
+		}
+	}
+}
+
 func (j *Jiacrontabd) recovery() {
 	var crontabJobs []models.CrontabJob
 	var daemonJobs []models.DaemonJob
@@ -437,17 +541,11 @@ func (j *Jiacrontabd) recovery() {
 	}
 
 	for _, v := range crontabJobs {
-		j.addJob(&crontab.Job{
-			ID:      v.ID,
-			Second:  v.TimeArgs.Second,
-			Minute:  v.TimeArgs.Minute,
-			Hour:    v.TimeArgs.Hour,
-			Day:     v.TimeArgs.Day,
-			Month:   v.TimeArgs.Month,
-			Weekday: v.TimeArgs.Weekday,
-		}, false)
+		j.scheduleRecovered(v)
 	}
 
+	j.recoverOneOffs()
+
 	err = models.DB().Find(&daemonJobs, "status in (?)", []models.JobStatus{models.StatusJobOk}).Error
 
 	if err != nil {
@@ -468,7 +566,7 @@ func (j *Jiacrontabd) init() {
 	if err := models.CreateDB(cfg.DriverName, cfg.DSN); err != nil {
 		panic(err)
 	}
-	models.DB().AutoMigrate(&models.CrontabJob{}, &models.DaemonJob{})
+	models.DB().AutoMigrate(&models.CrontabJob{}, &models.DaemonJob{}, &models.OneOffRun{})
 	j.startTime = time.Now()
 	if cfg.AutoCleanTaskLog {
 		go finder.SearchAndDeleteFileOnDisk(cfg.LogPath, 24*time.Hour*30, 1<<30)
@@ -482,6 +580,7 @@ func (j *Jiacrontabd) rpcCallCtx(ctx context.Context, serviceMethod string, args
 
 // Main main function
 func (j *Jiacrontabd) Main() {
+	j.locks.releaseAll()
 	j.init()
 	j.heartBeat()
 	go j.run()
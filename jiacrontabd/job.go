@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"jiacrontab/models"
 	"jiacrontab/pkg/crontab"
+	"jiacrontab/pkg/kproc"
 	"jiacrontab/pkg/proto"
 	"jiacrontab/pkg/util"
 	"path/filepath"
@@ -22,6 +23,10 @@ const (
 	exitSuccess     = "Success"
 	exitDependError = "Dependent job execution failed"
 	exitTimeout     = "Timeout"
+	exitDropped     = "Dropped"
+	exitReplaced    = "Replaced"
+	exitSkipped     = "Skipped"
+	exitOOMKilled   = "OOM killed"
 )
 
 type process struct {
@@ -35,6 +40,15 @@ type process struct {
 	ready     chan struct{}
 	retryNum  int
 	jobEntry  *JobEntry
+	replaced  int32 // 被replace策略结束
+
+	runID         string        // 同一次调度的各次尝试共用
+	queueTime     time.Duration // 等待命名锁和节点执行名额的时间
+	attemptStart  time.Time     // 本次尝试的开始时间
+	timedOut      int32         // 本次尝试是否超时
+	cancelAttempt context.CancelFunc
+	usage         kproc.Usage // 本次尝试的退出码和资源使用
+	stderr        []byte
 }
 
 func newProcess(id uint32, jobEntry *JobEntry) *process {
@@ -43,6 +57,7 @@ func newProcess(id uint32, jobEntry *JobEntry) *process {
 		jobEntry:  jobEntry,
 		startTime: time.Now(),
 		ready:     make(chan struct{}),
+		runID:     util.UUID(),
 	}
 
 	p.ctx, p.cancel = context.WithCancel(context.Background())
@@ -120,6 +135,14 @@ func (p *process) exec() error {
 		doneChan = make(chan struct{}, 1)
 	)
 
+	p.attemptStart = time.Now()
+	p.usage = kproc.Usage{ExitCode: -1}
+	atomic.StoreInt32(&p.timedOut, 0)
+	// 超时只结束本次尝试,不影响之后的重试
+	ctx, cancel := context.WithCancel(p.ctx)
+	p.cancelAttempt = cancel
+	defer cancel()
+
 	if ok = p.waitDepExecDone(); !ok {
 		p.jobEntry.handleDepError(p.startTime, p)
 	} else {
@@ -130,6 +153,7 @@ func (p *process) exec() error {
 					case <-doneChan:
 						close(doneChan)
 					default:
+						atomic.StoreInt32(&p.timedOut, 1)
 						log.Debug("timeout callback:", "jobID:", p.jobEntry.detail.ID)
 						p.jobEntry.timeoutTrigger(p)
 					}
@@ -143,7 +167,16 @@ func (p *process) exec() error {
 
 		myCmdUnit := cmdUint{
 			args:             [][]string{arg},
-			ctx:              p.ctx,
+			ctx:              ctx,
+			successRule:      p.jobEntry.detail.SuccessRule,
+			stopSignal:       p.jobEntry.detail.StopSignal,
+			gracePeriod:      time.Duration(p.jobEntry.detail.StopGracePeriod) * time.Second,
+			limits:           p.jobEntry.detail.Limits,
+			nice:             p.jobEntry.detail.Nice,
+			ioClass:          p.jobEntry.detail.IOClass,
+			ioPriority:       p.jobEntry.detail.IOPriority,
+			maxOutputSize:    p.jobEntry.detail.MaxOutputSize,
+			maxLogSize:       p.jobEntry.detail.MaxLogSize,
 			dir:              p.jobEntry.detail.WorkDir,
 			user:             p.jobEntry.detail.WorkUser,
 			env:              p.jobEntry.detail.WorkEnv,
@@ -161,6 +194,8 @@ func (p *process) exec() error {
 			myCmdUnit.exportLog = true
 		}
 		p.err = myCmdUnit.launch()
+		p.usage = myCmdUnit.usage
+		p.stderr = myCmdUnit.stderr
 		p.jobEntry.logContent = myCmdUnit.content
 		doneChan <- struct{}{}
 
@@ -191,16 +226,26 @@ type JobEntry struct {
 	once        bool  // 只执行一次
 	stop        int32 // job stop status
 	uniqueID    string
+	misfire     time.Time         // 补跑的原定执行时刻
+	oneOff      *models.OneOffRun // 一次性执行覆盖的参数
+	lastErr     error             // 最近一次执行的错误
+	released    *sync.Cond        // 有执行结束时通知排队的执行
+	queue       []*queuedRun      // 因达到最大并发数排队等待的执行
+
+	// skipped 最近一次调度时被排除日历跳过的执行,由jd.mux保护
+	skipped []models.SkippedExecution
 }
 
 func newJobEntry(job *crontab.Job, jd *Jiacrontabd) *JobEntry {
-	return &JobEntry{
+	j := &JobEntry{
 		uniqueID:  util.UUID(),
 		job:       job,
 		IDChan:    make(chan uint32, 10000),
 		processes: make(map[uint32]*process),
 		jd:        jd,
 	}
+	j.released = sync.NewCond(&j.mux)
+	return j
 }
 
 func (j *JobEntry) getLogPath() string {
@@ -403,7 +448,7 @@ func (j *JobEntry) timeoutTrigger(p *process) {
 			}
 		case proto.TimeoutTrigger_Kill:
 			j.detail.LastExitStatus = exitTimeout
-			p.cancel()
+			p.cancelAttempt()
 		case proto.TimeoutTrigger_DingdingWebhook:
 			j.detail.LastExitStatus = exitTimeout
 
@@ -443,10 +488,19 @@ func (j *JobEntry) exec() {
 
 	exec := func() {
 		var err error
+		defer func() {
+			j.lastErr = err
+		}()
 		now := time.Now()
+		finalStatus := models.StatusJobTiming
+		// 固定延迟调度在执行结束后才计算下次执行时间
+		fixedDelay := !j.once && j.job.FixedDelay
 		if j.once {
 			err = models.DB().Take(&j.detail, "id=?", j.job.ID).Error
 			atomic.StoreInt32(&j.processNum, int32(j.detail.ProcessNum))
+			if j.oneOff != nil {
+				j.oneOff.Override(&j.detail)
+			}
 		} else {
 			err = models.DB().Take(&j.detail, "id=? and status in(?)",
 				j.job.ID, []models.JobStatus{models.StatusJobTiming, models.StatusJobRunning}).Error
@@ -469,43 +523,75 @@ func (j *JobEntry) exec() {
 			if !(execTime.Equal(j.job.GetNextExecTime().Truncate(time.Second)) && execTime.Equal(now.Truncate(time.Second))) {
 				log.Errorf("%s(%d) JobEntry.exec time error(%s not equal %s)",
 					j.detail.Name, j.detail.ID, execTime, now)
-				j.jd.addJob(&crontab.Job{
-					ID:      j.detail.ID,
-					Second:  j.detail.TimeArgs.Second,
-					Minute:  j.detail.TimeArgs.Minute,
-					Hour:    j.detail.TimeArgs.Hour,
-					Day:     j.detail.TimeArgs.Day,
-					Month:   j.detail.TimeArgs.Month,
-					Weekday: j.detail.TimeArgs.Weekday,
-				}, false)
+				job, err := j.jd.newCrontabJob(&j.detail)
+				if err != nil {
+					log.Errorf("jobID(%d) JobEntry.exec: %v", j.detail.ID, err)
+					j.jd.calendars.wait(j.detail.ID, false)
+					return
+				}
+				if err := j.jd.addJob(job, false); crontab.IsFinished(err) {
+					j.jd.deleteJob(j.detail.ID)
+				}
 				return
 			}
-			j.jd.addJob(j.job, true)
+			if !fixedDelay {
+				if err := j.scheduleNext(); crontab.IsFinished(err) {
+					// 本次为最后一次执行
+					finalStatus = finishedStatus(err)
+					defer j.jd.deleteJob(j.detail.ID)
+				}
+			}
+		}
+
+		if !j.acquire(now) {
+			if fixedDelay {
+				if err := j.scheduleNext(); crontab.IsFinished(err) {
+					j.jd.deleteJob(j.detail.ID)
+				}
+			}
+			return
 		}
 
-		if atomic.LoadInt32(&j.processNum) >= int32(j.detail.MaxConcurrent) && j.detail.MaxConcurrent != 0 {
-			j.logContent = []byte("不得超过job最大并发数量\n")
+		// 先等待节点执行名额再等待命名锁,持有锁的执行都已取得名额,
+		// 等待名额时不会占用锁阻塞其他节点
+		queueStart := time.Now()
+		if !j.jd.slots.acquire(j, j.detail.PriorityClass) {
+			j.release()
+			return
+		}
+		lockHolder := fmt.Sprintf("crontab:%d:%s", j.detail.ID, util.UUID())
+		stopped := func() bool { return atomic.LoadInt32(&j.stop) == 1 }
+		if !j.jd.locks.lock(j.detail.Locks, lockHolder, j.detail.ClusterLock, stopped) {
+			j.jd.slots.release()
+			j.release()
 			return
 		}
+		defer j.jd.locks.unlock(j.detail.Locks, lockHolder, j.detail.ClusterLock)
+		queueTime := time.Since(queueStart)
 
-		if atomic.LoadInt32(&j.processNum) == 0 {
+		if atomic.LoadInt32(&j.processNum) == 1 {
 			j.logContent = nil
 		}
 
-		atomic.AddInt32(&j.processNum, 1)
-
 		id := j.takeID()
+		p := newProcess(id, j)
+		p.queueTime = queueTime
 		startTime := time.Now()
 		var endTime time.Time
 		defer func() {
 			endTime = time.Now()
-			atomic.AddInt32(&j.processNum, -1)
-			j.updateJob(models.StatusJobTiming, startTime, endTime, err)
+			j.jd.slots.release()
+			j.release()
+			if fixedDelay {
+				if err := j.scheduleNext(); crontab.IsFinished(err) {
+					finalStatus = finishedStatus(err)
+					defer j.jd.deleteJob(j.detail.ID)
+				}
+			}
+			j.updateJob(finalStatus, p, startTime, endTime, err)
 		}()
 
-		j.updateJob(models.StatusJobRunning, startTime, endTime, err)
-
-		p := newProcess(id, j)
+		j.updateJob(models.StatusJobRunning, p, startTime, endTime, err)
 
 		j.mux.Lock()
 		j.processes[id] = p
@@ -524,14 +610,29 @@ func (j *JobEntry) exec() {
 				return
 			}
 
+			if i > 0 && !j.waitRetry(p, i) {
+				return
+			}
+
 			log.Debug("jobID:", j.detail.ID, "retryNum:", i)
 
 			p.retryNum = i
 
 			// 执行脚本
-			if err = p.exec(); err == nil || j.once {
+			if err = p.exec(); err == nil || (j.once && j.misfire.IsZero()) {
 				break
 			}
+
+			if atomic.LoadInt32(&p.replaced) == 1 {
+				err = errReplaced
+				break
+			}
+
+			if i == j.detail.RetryNum || !j.detail.RetryPolicy.ShouldRetry(p.usage.ExitCode, atomic.LoadInt32(&p.timedOut) == 1, p.stderr) {
+				break
+			}
+			// 失败的尝试单独记录,最后一次尝试由updateJob记录
+			j.pushAttempt(p, err)
 		}
 	}
 
@@ -543,12 +644,38 @@ func (j *JobEntry) exec() {
 	j.wg.Wrap(exec)
 }
 
-func (j *JobEntry) updateJob(status models.JobStatus, startTime, endTime time.Time, err error) {
+// scheduleNext 计算下次执行时间并放入调度队列
+// 固定延迟调度在执行结束时调用,此时job可能已被停止
+func (j *JobEntry) scheduleNext() error {
+	if atomic.LoadInt32(&j.stop) == 1 {
+		return nil
+	}
+	// 排除日历可能已在admin中修改
+	calendars, err := j.jd.calendars.get(j.detail.Calendars, j.detail.CalendarRules)
+	if err != nil {
+		log.Errorf("jobID(%d) scheduleNext: %v", j.detail.ID, err)
+		j.jd.calendars.wait(j.detail.ID, false)
+		return err
+	}
+	j.job.Calendars = calendars
+	return j.jd.addJob(j.job, true)
+}
+
+func (j *JobEntry) updateJob(status models.JobStatus, p *process, startTime, endTime time.Time, err error) {
 	data := map[string]interface{}{
 		"status":           status,
 		"process_num":      atomic.LoadInt32(&j.processNum),
 		"last_exit_status": "",
 		"failed":           false,
+		"last_queue_time":  p.queueTime.Seconds(),
+	}
+
+	if status != models.StatusJobRunning && !p.attemptStart.IsZero() {
+		data["last_exit_code"] = p.usage.ExitCode
+		data["last_signal"] = p.usage.Signal
+		data["last_user_time"] = p.usage.UserTime.Seconds()
+		data["last_sys_time"] = p.usage.SysTime.Seconds()
+		data["last_max_rss"] = p.usage.MaxRSS
 	}
 
 	if endTime.After(startTime) {
@@ -567,18 +694,11 @@ func (j *JobEntry) updateJob(status models.JobStatus, startTime, endTime time.Ti
 		delete(data, "last_exit_status")
 	}
 
-	if status == models.StatusJobTiming {
-		if err = j.jd.rpcCallCtx(context.TODO(), "Srv.PushJobLog", models.JobHistory{
-			JobType:   models.JobTypeCrontab,
-			JobID:     j.detail.ID,
-			Addr:      j.jd.getOpts().BoardcastAddr,
-			JobName:   j.detail.Name,
-			StartTime: startTime,
-			EndTime:   endTime,
-			ExitMsg:   errMsg,
-		}, nil); err != nil {
-			log.Error("rpc call Srv.PushJobLog failed:", err)
+	if status != models.StatusJobRunning {
+		if !p.attemptStart.IsZero() {
+			startTime = p.attemptStart
 		}
+		j.pushHistory(p, startTime, endTime, err)
 	}
 
 	models.DB().Model(&j.detail).Updates(data)
@@ -601,5 +721,8 @@ func (j *JobEntry) exit() {
 	for _, v := range j.processes {
 		v.cancel()
 	}
+	// 唤醒排队的执行使其放弃
+	j.released.Broadcast()
 	j.mux.Unlock()
+	j.jd.slots.cancel(j)
 }
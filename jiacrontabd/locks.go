@@ -0,0 +1,160 @@
+package jiacrontabd
+
+import (
+	"context"
+	"jiacrontab/pkg/proto"
+	"sync"
+	"time"
+
+	"github.com/iwannay/log"
+)
+
+// lockRetryInterval 锁被占用时重试的间隔
+const lockRetryInterval = time.Second
+
+// lockGroups 命名锁,持有同名锁的job不会同时执行
+// 节点锁只在本节点内互斥,集群锁还需由admin仲裁
+type lockGroups struct {
+	mux      sync.Mutex
+	held     map[string]string        // 锁名称 -> 持有者
+	renewing map[string]chan struct{} // 集群锁持有者 -> 停止续约
+	jd       *Jiacrontabd
+}
+
+func newLockGroups(jd *Jiacrontabd) *lockGroups {
+	return &lockGroups{
+		held:     make(map[string]string),
+		renewing: make(map[string]chan struct{}),
+		jd:       jd,
+	}
+}
+
+// lock 阻塞直到取得全部names对应的锁,stopped返回true时放弃并返回false
+func (l *lockGroups) lock(names []string, holder string, cluster bool, stopped func() bool) bool {
+	if len(names) == 0 {
+		return true
+	}
+	for {
+		if l.tryLock(names, holder) {
+			if !cluster {
+				return true
+			}
+			ok, err := l.tryClusterLock(names, holder)
+			if err != nil {
+				log.Error("Srv.AcquireLocks error:", err)
+			}
+			if ok {
+				l.startRenew(names, holder)
+				return true
+			}
+			l.unlockLocal(names, holder)
+		}
+		if stopped() {
+			return false
+		}
+		time.Sleep(lockRetryInterval)
+	}
+}
+
+// unlock 释放holder持有的锁
+func (l *lockGroups) unlock(names []string, holder string, cluster bool) {
+	if len(names) == 0 {
+		return
+	}
+	if cluster {
+		l.stopRenew(holder)
+		var reply bool
+		if err := l.jd.rpcCallCtx(context.TODO(), "Srv.ReleaseLocks", proto.LockArgs{
+			Addr:   l.jd.getOpts().BoardcastAddr,
+			Holder: holder,
+			Names:  names,
+		}, &reply); err != nil {
+			// 释放失败时由租约到期兜底
+			log.Error("Srv.ReleaseLocks error:", err)
+		}
+	}
+	l.unlockLocal(names, holder)
+}
+
+// releaseAll 释放本节点重启前持有的集群锁
+func (l *lockGroups) releaseAll() {
+	var reply bool
+	if err := l.jd.rpcCallCtx(context.TODO(), "Srv.ReleaseLocks", proto.LockArgs{
+		Addr: l.jd.getOpts().BoardcastAddr,
+	}, &reply); err != nil {
+		log.Error("Srv.ReleaseLocks error:", err)
+	}
+}
+
+func (l *lockGroups) tryLock(names []string, holder string) bool {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	for _, name := range names {
+		if h, ok := l.held[name]; ok && h != holder {
+			return false
+		}
+	}
+	for _, name := range names {
+		l.held[name] = holder
+	}
+	return true
+}
+
+func (l *lockGroups) unlockLocal(names []string, holder string) {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	for _, name := range names {
+		if l.held[name] == holder {
+			delete(l.held, name)
+		}
+	}
+}
+
+// startRenew 持有集群锁期间每个心跳周期续约一次,执行结束时由unlock停止
+// 节点停止或续约失败超过租约后由admin判定过期
+func (l *lockGroups) startRenew(names []string, holder string) {
+	done := make(chan struct{})
+	l.mux.Lock()
+	l.renewing[holder] = done
+	l.mux.Unlock()
+
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			case <-time.After(time.Duration(l.jd.getOpts().ClientAliveInterval) * time.Second):
+			}
+			ok, err := l.tryClusterLock(names, holder)
+			if err != nil {
+				log.Error("Srv.AcquireLocks error:", err)
+			} else if !ok {
+				log.Errorf("cluster locks %v of %s expired", names, holder)
+			}
+		}
+	}()
+}
+
+func (l *lockGroups) stopRenew(holder string) {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	if done, ok := l.renewing[holder]; ok {
+		close(done)
+		delete(l.renewing, holder)
+	}
+}
+
+// tryClusterLock 租约为三个心跳周期,持有者再次取得时续约
+func (l *lockGroups) tryClusterLock(names []string, holder string) (bool, error) {
+	var (
+		reply bool
+		cfg   = l.jd.getOpts()
+	)
+	err := l.jd.rpcCallCtx(context.TODO(), "Srv.AcquireLocks", proto.LockArgs{
+		Addr:   cfg.BoardcastAddr,
+		Holder: holder,
+		Names:  names,
+		Lease:  3 * cfg.ClientAliveInterval,
+	}, &reply)
+	return reply, err
+}
@@ -0,0 +1,55 @@
+package jiacrontabd
+
+import (
+	"jiacrontab/models"
+	"jiacrontab/pkg/proto"
+	"jiacrontab/pkg/test"
+	"testing"
+	"time"
+)
+
+func (a *fakeAdmin) AcquireLocks(args proto.LockArgs, reply *bool) error {
+	a.mux.Lock()
+	a.acquires++
+	a.mux.Unlock()
+	*reply = true
+	return nil
+}
+
+func (a *fakeAdmin) ReleaseLocks(args proto.LockArgs, reply *bool) error {
+	a.mux.Lock()
+	a.releases++
+	a.mux.Unlock()
+	*reply = true
+	return nil
+}
+
+func (a *fakeAdmin) lockCalls() (int, int) {
+	a.mux.Lock()
+	defer a.mux.Unlock()
+	return a.acquires, a.releases
+}
+
+func TestLockGroups_ClusterRenew(t *testing.T) {
+	j, admin := newTestEntry(t, models.CrontabJob{})
+	j.jd.getOpts().ClientAliveInterval = 1
+	l := j.jd.locks
+	never := func() bool { return false }
+
+	test.Equal(t, true, l.lock([]string{"db"}, "backup", true, never))
+	// 本节点的其他执行等待本地锁
+	test.Equal(t, false, l.tryLock([]string{"db"}, "vacuum"))
+
+	// 持有期间按心跳周期续约
+	time.Sleep(1500 * time.Millisecond)
+	acquires, _ := admin.lockCalls()
+	test.Equal(t, 2, acquires)
+
+	// 释放后停止续约
+	l.unlock([]string{"db"}, "backup", true)
+	time.Sleep(1200 * time.Millisecond)
+	acquires, releases := admin.lockCalls()
+	test.Equal(t, 2, acquires)
+	test.Equal(t, 1, releases)
+	test.Equal(t, true, l.tryLock([]string{"db"}, "vacuum"))
+}
@@ -0,0 +1,151 @@
+package jiacrontabd
+
+import (
+	"context"
+	"fmt"
+	"jiacrontab/models"
+	"jiacrontab/pkg/crontab"
+	"time"
+
+	"github.com/iwannay/log"
+)
+
+// maxMisfireScan 统计错过的执行时刻时最多遍历的次数
+const maxMisfireScan = 1000
+
+// missedExecTimes 根据上次执行时间和数据库中记录的下次执行时间
+// 计算节点停机期间错过的执行时刻,最多返回maxMisfireScan个,last为最后一个错过的执行时刻
+func missedExecTimes(job *crontab.Job, last, next, now time.Time) (missed []time.Time, lastMissed time.Time) {
+	var err error
+
+	// 下次执行时间不晚于上次执行时间时说明记录已失效,从上次执行时间重新计算
+	if next.IsZero() || !next.After(last) {
+		if last.IsZero() {
+			return nil, time.Time{}
+		}
+		if next, err = job.NextExecutionTime(last); err != nil {
+			return nil, time.Time{}
+		}
+	}
+
+	for next.Before(now) && len(missed) < maxMisfireScan {
+		missed = append(missed, next)
+		if next, err = job.NextExecutionTime(next); err != nil {
+			break
+		}
+	}
+	if len(missed) == 0 {
+		return nil, time.Time{}
+	}
+	lastMissed = missed[len(missed)-1]
+	if err == nil && next.Before(now) {
+		if job.Jitter > 0 || job.Spread > 0 {
+			// 加上偏移后的执行时间不一定随起点单调,不能二分查找,逐个遍历
+			for err == nil && next.Before(now) {
+				lastMissed = next
+				next, err = job.NextExecutionTime(next)
+			}
+		} else {
+			lastMissed = lastExecBefore(job, lastMissed, now)
+		}
+	}
+	return missed, lastMissed
+}
+
+// lastExecBefore 返回from之后早于now的最后一个执行时刻,没有时返回from
+// 没有Jitter和Spread时下次执行时间随起点单调不减,在(from, now)内二分查找,避免逐个遍历
+func lastExecBefore(job *crontab.Job, from, now time.Time) time.Time {
+	before := func(t time.Time) bool {
+		next, err := job.NextExecutionTime(t)
+		return err == nil && next.Before(now)
+	}
+	if !before(from) {
+		return from
+	}
+	lo, hi := from, now
+	for hi.Sub(lo) > time.Second {
+		mid := lo.Add(hi.Sub(lo) / 2)
+		if before(mid) {
+			lo = mid
+		} else {
+			hi = mid
+		}
+	}
+	ret, _ := job.NextExecutionTime(lo)
+	for {
+		next, err := job.NextExecutionTime(ret)
+		if err != nil || !next.Before(now) {
+			return ret
+		}
+		ret = next
+	}
+}
+
+// planMisfire 按job的misfire策略返回需要补跑的执行时刻和放弃的次数
+func planMisfire(job models.CrontabJob, missed []time.Time, last time.Time) (runs []time.Time, skipped int) {
+	switch job.MisfirePolicy {
+	case models.MisfireRunOnce:
+		runs = []time.Time{last}
+	case models.MisfireRunAll:
+		limit := job.MisfireLimit
+		if limit <= 0 {
+			limit = models.DefaultMisfireLimit
+		}
+		runs = missed
+		if len(runs) > limit {
+			runs = runs[:limit]
+		}
+	}
+	return runs, len(missed) - len(runs)
+}
+
+// handleMisfire 按job的misfire策略处理错过的执行
+// 补跑的执行记录到JobHistory,放弃的执行合并为一条记录
+func (j *Jiacrontabd) handleMisfire(job models.CrontabJob, missed []time.Time, last time.Time) {
+	if len(missed) == 0 {
+		return
+	}
+
+	runs, skipped := planMisfire(job, missed, last)
+	num := fmt.Sprint(skipped)
+	if len(missed) >= maxMisfireScan {
+		num += "+"
+	}
+	if skipped > 0 {
+		log.Infof("jobID(%d) misfire: skipped %s missed run(s)", job.ID, num)
+	}
+
+	if skipped > 0 {
+		now := time.Now()
+		msg := fmt.Sprintf("Misfire: skipped %s of missed run(s) between %s and %s",
+			num, missed[0].Format(time.RFC3339), last.Format(time.RFC3339))
+		if err := j.rpcCallCtx(context.TODO(), "Srv.PushJobLog", models.JobHistory{
+			JobType:       models.JobTypeCrontab,
+			JobID:         job.ID,
+			Addr:          j.getOpts().BoardcastAddr,
+			JobName:       job.Name,
+			StartTime:     now,
+			EndTime:       now,
+			ExitMsg:       msg,
+			Misfire:       true,
+			ScheduledTime: missed[0],
+		}, nil); err != nil {
+			log.Error("rpc call Srv.PushJobLog failed:", err)
+		}
+	}
+
+	// 按原定执行时刻依次补跑
+	for _, t := range runs {
+		log.Infof("jobID(%d) misfire: run missed execution at %s", job.ID, t)
+		ins := newJobEntry(&crontab.Job{
+			ID:     job.ID,
+			Value:  job,
+			Market: "补跑",
+		}, j)
+		ins.setOnce(true)
+		ins.misfire = t
+		j.addTmpJob(ins)
+		ins.exec()
+		j.removeTmpJob(ins)
+	}
+}
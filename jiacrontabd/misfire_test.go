@@ -0,0 +1,110 @@
+package jiacrontabd
+
+import (
+	"jiacrontab/models"
+	"jiacrontab/pkg/crontab"
+	"jiacrontab/pkg/test"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMissedExecTimes(t *testing.T) {
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.Local)
+	everyMinute := &crontab.Job{Second: "0", Minute: "*", Hour: "*", Day: "*", Weekday: "*", Month: "*"}
+	everySecond := &crontab.Job{Second: "*", Minute: "*", Hour: "*", Day: "*", Weekday: "*", Month: "*"}
+
+	tests := []struct {
+		name       string
+		job        *crontab.Job
+		next       time.Time
+		now        time.Time
+		missed     int
+		first      time.Time
+		lastMissed time.Time
+	}{
+		{"none", everyMinute, start.Add(time.Minute), start.Add(30 * time.Second), 0, time.Time{}, time.Time{}},
+		{"missed", everyMinute, start.Add(time.Minute), start.Add(5*time.Minute + 30*time.Second), 5, start.Add(time.Minute), start.Add(5 * time.Minute)},
+		// 下次执行时间失效时从上次执行时间重新计算
+		{"stale next", everyMinute, start, start.Add(3*time.Minute + 30*time.Second), 3, start.Add(time.Minute), start.Add(3 * time.Minute)},
+		// 超过maxMisfireScan时只返回最早的部分,最后一个错过的时刻仍然准确
+		{"capped", everySecond, start.Add(time.Second), start.Add(2*time.Hour + 500*time.Millisecond), maxMisfireScan, start.Add(time.Second), start.Add(2 * time.Hour)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			missed, last := missedExecTimes(tt.job, start, tt.next, tt.now)
+			test.Equal(t, tt.missed, len(missed))
+			test.Equal(t, tt.lastMissed, last)
+			if len(missed) > 0 {
+				test.Equal(t, tt.first, missed[0])
+			}
+		})
+	}
+}
+
+func TestMissedExecTimesJitter(t *testing.T) {
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.Local)
+	now := start.Add(3 * time.Hour)
+	job := &crontab.Job{Second: "*/10", Minute: "*", Hour: "*", Day: "*", Weekday: "*", Month: "*", Jitter: 5 * time.Second}
+
+	// 有Jitter时执行时间不单调,超过maxMisfireScan后逐个遍历到now
+	missed, last := missedExecTimes(job, start, start.Add(10*time.Second), now)
+	test.Equal(t, maxMisfireScan, len(missed))
+	test.Equal(t, true, last.Before(now))
+	test.Equal(t, true, now.Sub(last) <= 15*time.Second)
+}
+
+func TestPlanMisfire(t *testing.T) {
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.Local)
+	missed := func(n int) []time.Time {
+		var ret []time.Time
+		for i := 1; i <= n; i++ {
+			ret = append(ret, start.Add(time.Duration(i)*time.Minute))
+		}
+		return ret
+	}
+	// 超过maxMisfireScan时last晚于missed中的最后一个
+	capped := missed(maxMisfireScan)
+	cappedLast := start.Add(2 * maxMisfireScan * time.Minute)
+
+	tests := []struct {
+		name    string
+		policy  string
+		limit   int
+		missed  []time.Time
+		last    time.Time
+		runs    []time.Time
+		skipped int
+	}{
+		{"default skip", "", 0, missed(5), start.Add(5 * time.Minute), nil, 5},
+		{"skip", models.MisfireSkip, 0, missed(5), start.Add(5 * time.Minute), nil, 5},
+		{"runOnce", models.MisfireRunOnce, 0, missed(5), start.Add(5 * time.Minute), []time.Time{start.Add(5 * time.Minute)}, 4},
+		{"runOnce capped", models.MisfireRunOnce, 0, capped, cappedLast, []time.Time{cappedLast}, maxMisfireScan - 1},
+		{"runAll", models.MisfireRunAll, 0, missed(5), start.Add(5 * time.Minute), missed(5), 0},
+		{"runAll limit", models.MisfireRunAll, 3, missed(5), start.Add(5 * time.Minute), missed(3), 2},
+		{"runAll capped", models.MisfireRunAll, 0, capped, cappedLast, missed(models.DefaultMisfireLimit), maxMisfireScan - models.DefaultMisfireLimit},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runs, skipped := planMisfire(models.CrontabJob{
+				MisfirePolicy: tt.policy,
+				MisfireLimit:  tt.limit,
+			}, tt.missed, tt.last)
+			test.Equal(t, tt.runs, runs)
+			test.Equal(t, tt.skipped, skipped)
+		})
+	}
+}
+
+func TestHandleMisfireSkip(t *testing.T) {
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.Local)
+	j, admin := newTestEntry(t, models.CrontabJob{})
+	missed := []time.Time{start.Add(time.Minute), start.Add(2 * time.Minute), start.Add(3 * time.Minute)}
+
+	// skip策略同样记录放弃的执行
+	j.jd.handleMisfire(models.CrontabJob{Name: "backup", MisfirePolicy: models.MisfireSkip}, missed, missed[2])
+	test.Equal(t, 1, len(admin.histories))
+	test.Equal(t, true, admin.histories[0].Misfire)
+	test.Equal(t, missed[0].Unix(), admin.histories[0].ScheduledTime.Unix())
+	test.Equal(t, true, strings.Contains(admin.histories[0].ExitMsg, "skipped 3 of missed run(s)"))
+}
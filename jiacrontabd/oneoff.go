@@ -0,0 +1,153 @@
+package jiacrontabd
+
+import (
+	"fmt"
+	"jiacrontab/models"
+	"jiacrontab/pkg/crontab"
+	"time"
+
+	"github.com/iwannay/log"
+)
+
+// addOneOff 将一次性执行放入调度队列
+func (j *Jiacrontabd) addOneOff(run *models.OneOffRun) {
+	task := &crontab.Task{
+		Value:    run,
+		Priority: run.RunAt.UnixNano(),
+	}
+	j.mux.Lock()
+	j.oneOffs[run.ID] = task
+	j.mux.Unlock()
+	j.crontab.AddTask(task)
+}
+
+// removeOneOff 将一次性执行移出调度队列
+func (j *Jiacrontabd) removeOneOff(id uint) {
+	j.mux.Lock()
+	task, ok := j.oneOffs[id]
+	delete(j.oneOffs, id)
+	j.mux.Unlock()
+	if ok {
+		j.crontab.RemoveTask(task)
+	}
+}
+
+// oneOffAllowed 未审核或已停止的job不允许执行一次
+func oneOffAllowed(job models.CrontabJob) error {
+	switch job.Status {
+	case models.StatusJobUnaudited:
+		return fmt.Errorf("job %s is unaudited", job.Name)
+	case models.StatusJobStop:
+		return fmt.Errorf("job %s is stopped", job.Name)
+	}
+	return nil
+}
+
+// execOneOff 执行到期的一次性执行,已取消的不再执行
+// 等待期间job被修改为未审核或被停止时记为失败
+func (j *Jiacrontabd) execOneOff(run *models.OneOffRun) {
+	j.mux.Lock()
+	delete(j.oneOffs, run.ID)
+	j.mux.Unlock()
+
+	ret := models.DB().Model(&models.OneOffRun{}).Where("id=? and status=?", run.ID, models.OneOffPending).
+		Updates(map[string]interface{}{
+			"status":     models.OneOffRunning,
+			"start_time": time.Now(),
+		})
+	if ret.Error != nil {
+		log.Error("execOneOff:", ret.Error)
+		return
+	}
+	if ret.RowsAffected == 0 {
+		return
+	}
+
+	var job models.CrontabJob
+	err := models.DB().Take(&job, "id=?", run.JobID).Error
+	if err == nil {
+		err = oneOffAllowed(job)
+	}
+	if err != nil {
+		if err := models.DB().Model(&models.OneOffRun{}).Where("id=?", run.ID).Updates(map[string]interface{}{
+			"status":   models.OneOffFailed,
+			"end_time": time.Now(),
+			"exit_msg": err.Error(),
+		}).Error; err != nil {
+			log.Error("execOneOff:", err)
+		}
+		return
+	}
+
+	ins := newJobEntry(&crontab.Job{
+		ID:     run.JobID,
+		Value:  run,
+		Market: "定时执行一次",
+	}, j)
+	ins.setOnce(true)
+	ins.oneOff = run
+	j.addTmpJob(ins)
+	ins.exec()
+	j.removeTmpJob(ins)
+
+	data := map[string]interface{}{
+		"status":   models.OneOffSucceeded,
+		"end_time": time.Now(),
+		"exit_msg": "",
+	}
+	if ins.lastErr != nil {
+		data["status"] = models.OneOffFailed
+		data["exit_msg"] = ins.lastErr.Error()
+	}
+	if err := models.DB().Model(&models.OneOffRun{}).Where("id=?", run.ID).Updates(data).Error; err != nil {
+		log.Error("execOneOff:", err)
+	}
+}
+
+// recoverOneOffs 节点启动时恢复等待中的一次性执行
+// 到期的会立即执行,重启前未执行完的记为失败
+func (j *Jiacrontabd) recoverOneOffs() {
+	var runs []models.OneOffRun
+
+	if err := models.DB().Model(&models.OneOffRun{}).Where("status=?", models.OneOffRunning).
+		Updates(map[string]interface{}{
+			"status":   models.OneOffFailed,
+			"end_time": time.Now(),
+			"exit_msg": "节点重启,执行被中断",
+		}).Error; err != nil {
+		log.Debug("oneOff recovery:", err)
+	}
+
+	if err := models.DB().Find(&runs, "status=?", models.OneOffPending).Error; err != nil {
+		log.Debug("oneOff recovery:", err)
+	}
+
+	for k := range runs {
+		j.addOneOff(&runs[k])
+	}
+}
+
+// cancelOneOffs 取消model条件下等待中的一次性执行
+func (j *Jiacrontabd) cancelOneOffs(model *models.D, reason string) ([]models.OneOffRun, error) {
+	var runs []models.OneOffRun
+	if err := model.Find(&runs, "status=?", models.OneOffPending).Error; err != nil {
+		return nil, err
+	}
+
+	var ids []uint
+	for k, v := range runs {
+		j.removeOneOff(v.ID)
+		ids = append(ids, v.ID)
+		runs[k].Status = models.OneOffCanceled
+		runs[k].ExitMsg = reason
+	}
+	if len(ids) == 0 {
+		return runs, nil
+	}
+
+	return runs, models.DB().Model(&models.OneOffRun{}).Where("id in (?) and status=?", ids, models.OneOffPending).
+		Updates(map[string]interface{}{
+			"status":   models.OneOffCanceled,
+			"exit_msg": reason,
+		}).Error
+}
@@ -0,0 +1,43 @@
+package jiacrontabd
+
+import (
+	"jiacrontab/models"
+	"jiacrontab/pkg/proto"
+	"jiacrontab/pkg/test"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCrontabJob_RunOnce(t *testing.T) {
+	test.Nil(t, models.CreateDB("sqlite3", filepath.Join(t.TempDir(), "node.db")))
+	test.Nil(t, models.DB().AutoMigrate(&models.CrontabJob{}, &models.OneOffRun{}))
+
+	srv := newCrontabJobSrv(New(NewConfig()))
+	run := func(job models.CrontabJob, args proto.RunOnceArgs) error {
+		test.Nil(t, models.DB().Create(&job).Error)
+		args.JobID = job.ID
+		args.GroupID = job.GroupID
+		args.UserID = job.CreatedUserID
+		args.Delay = time.Hour
+		var reply models.OneOffRun
+		return srv.RunOnce(args, &reply)
+	}
+	job := models.CrontabJob{Name: "backup", GroupID: 2, CreatedUserID: 3, Status: models.StatusJobTiming}
+
+	test.Nil(t, run(job, proto.RunOnceArgs{Timeout: 10}))
+	// 普通用户不能覆盖命令
+	test.NotNil(t, run(job, proto.RunOnceArgs{Code: "rm -rf /"}))
+	test.NotNil(t, run(job, proto.RunOnceArgs{WorkDir: "/"}))
+	test.Nil(t, run(job, proto.RunOnceArgs{Root: true, Code: "echo once"}))
+
+	// 未审核和已停止的job不能执行
+	job.Status = models.StatusJobUnaudited
+	test.NotNil(t, run(job, proto.RunOnceArgs{Root: true}))
+	job.Status = models.StatusJobStop
+	test.NotNil(t, run(job, proto.RunOnceArgs{Root: true}))
+
+	var count int64
+	test.Nil(t, models.DB().Model(&models.OneOffRun{}).Count(&count).Error)
+	test.Equal(t, int64(2), count)
+}
@@ -0,0 +1,187 @@
+package jiacrontabd
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"jiacrontab/models"
+	"jiacrontab/pkg/proto"
+	"time"
+)
+
+// outputDrainTimeout 进程退出后等待读完输出的时间,后台进程仍持有管道时不再等待
+const outputDrainTimeout = time.Second
+
+// streamTag 日志行的前缀,标记输出流和写入时间,日志文件按天分目录所以只记录时刻
+func streamTag(stream string, t time.Time) string {
+	return fmt.Sprintf("[%s %s] ", stream, t.Format("15:04:05.000"))
+}
+
+// streamPrefix 按输出流筛选日志时匹配的行前缀
+func streamPrefix(stream string) string {
+	if stream == "" {
+		return ""
+	}
+	return "[" + stream + " "
+}
+
+// stripStreamTags 去掉日志行的输出流标记,
+// 返回给admin的执行结果和依赖的输出保持原来的格式
+func stripStreamTags(content []byte) []byte {
+	var ret []byte
+	for _, line := range bytes.SplitAfter(content, []byte{'\n'}) {
+		for _, stream := range []string{models.StreamStdout, models.StreamStderr, models.StreamSystem} {
+			if !bytes.HasPrefix(line, []byte(streamPrefix(stream))) {
+				continue
+			}
+			if i := bytes.Index(line, []byte("] ")); i > 0 {
+				line = line[i+2:]
+			}
+			break
+		}
+		ret = append(ret, line...)
+	}
+	return ret
+}
+
+// maxLineSize 单行输出的上限,超出时拆分为多行
+const maxLineSize = 64 << 10
+
+// lineWriter 将输出按行交给cmdUint,每个输出流使用各自的lineWriter
+type lineWriter struct {
+	cu     *cmdUint
+	stream string
+	buf    []byte
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	w.buf = append(w.buf, p...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			// 进度条等不换行的输出达到上限时先按一行写入,避免一直缓存
+			if len(w.buf) < maxLineSize {
+				break
+			}
+			i = maxLineSize - 1
+		}
+		w.cu.output(w.stream, w.buf[:i+1])
+		w.buf = w.buf[i+1:]
+	}
+	return len(p), nil
+}
+
+// flush 写入最后一行没有换行符的输出
+func (w *lineWriter) flush() {
+	if len(w.buf) > 0 {
+		w.cu.output(w.stream, w.buf)
+		w.buf = nil
+	}
+}
+
+// readStream 读取输出流直到EOF或被关闭
+func (cu *cmdUint) readStream(stream string, r io.Reader) {
+	w := &lineWriter{cu: cu, stream: stream}
+	io.Copy(w, r)
+	w.flush()
+}
+
+// output 记录进程的一行输出,stdout和stderr并发调用
+func (cu *cmdUint) output(stream string, line []byte) {
+	cfg := cu.jd.getOpts()
+
+	cu.mux.Lock()
+	defer cu.mux.Unlock()
+
+	cu.hasOutput = true
+	if stream == models.StreamStderr {
+		cu.appendStderr(line)
+	}
+	cu.checker.feed(stream, line)
+
+	buf := make([]byte, 0, len(line)+64)
+	if cfg.VerboseJobLog {
+		buf = append(buf, fmt.Sprintf("[%s %s %s] ", time.Now().Format(proto.DefaultTimeLayout), cfg.BoardcastAddr, cu.label)...)
+	}
+	if len(cu.market) > 0 {
+		buf = append(buf, "["+cu.market+"]"...)
+	}
+	buf = append(buf, line...)
+	cu.writeLine(stream, buf)
+}
+
+// writeLine 加上输出流标记后写入日志,调用方需持有cu.mux
+func (cu *cmdUint) writeLine(stream string, line []byte) {
+	buf := append([]byte(streamTag(stream, time.Now())), line...)
+	if !bytes.HasSuffix(buf, []byte{'\n'}) {
+		buf = append(buf, '\n')
+	}
+	if cu.exportLog {
+		cu.captured.Write(buf)
+	}
+	cu.writeLog(buf)
+}
+
+// cappedOutput 保存执行输出,超出上限时保留开头和结尾各一半,中间只记录被截断的字节数
+type cappedOutput struct {
+	limit     int // 为0时不限制
+	head      []byte
+	tail      []byte
+	truncated int64
+}
+
+func (c *cappedOutput) Write(p []byte) {
+	if c.limit <= 0 {
+		c.head = append(c.head, p...)
+		return
+	}
+	if n := c.limit/2 - len(c.head); n > 0 && len(c.tail) == 0 && c.truncated == 0 {
+		if n > len(p) {
+			n = len(p)
+		}
+		c.head = append(c.head, p[:n]...)
+		p = p[n:]
+	}
+	c.tail = append(c.tail, p...)
+	// 超出一倍后再整理,避免每次写入都移动数据
+	if len(c.tail) > 2*c.tailLimit() {
+		c.compact()
+	}
+}
+
+func (c *cappedOutput) tailLimit() int {
+	return c.limit - c.limit/2
+}
+
+// compact 丢弃超出tailLimit的部分,并从下一个完整的行开始保留
+func (c *cappedOutput) compact() {
+	drop := len(c.tail) - c.tailLimit()
+	if drop <= 0 {
+		return
+	}
+	if i := bytes.IndexByte(c.tail[drop:], '\n'); i >= 0 {
+		drop += i + 1
+	}
+	c.truncated += int64(drop)
+	c.tail = append(c.tail[:0], c.tail[drop:]...)
+}
+
+// Bytes 返回保留的输出,有截断时在开头和结尾之间插入截断标记
+func (c *cappedOutput) Bytes() []byte {
+	c.compact()
+	if c.truncated == 0 {
+		return append(c.head[:len(c.head):len(c.head)], c.tail...)
+	}
+	ret := make([]byte, 0, len(c.head)+len(c.tail)+64)
+	ret = append(ret, c.head...)
+	if len(ret) > 0 && ret[len(ret)-1] != '\n' {
+		ret = append(ret, '\n')
+	}
+	ret = append(ret, truncatedMarker(c.truncated)...)
+	return append(ret, c.tail...)
+}
+
+// truncatedMarker 截断标记
+func truncatedMarker(n int64) string {
+	return streamTag(models.StreamSystem, time.Now()) + fmt.Sprintf("truncated %d bytes\n", n)
+}
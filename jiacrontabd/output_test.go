@@ -0,0 +1,70 @@
+package jiacrontabd
+
+import (
+	"jiacrontab/pkg/test"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestStripStreamTags(t *testing.T) {
+	content := "[stdout 10:00:00.000] out 0\n" +
+		"[stderr 10:00:00.001] [2020-10-01 10:00:00 127.0.0.1 test] err 0\n" +
+		"[system 10:00:00.002] exit status 1\n" +
+		"[手动执行]out 1"
+	test.Equal(t, "out 0\n"+
+		"[2020-10-01 10:00:00 127.0.0.1 test] err 0\n"+
+		"exit status 1\n"+
+		"[手动执行]out 1", string(stripStreamTags([]byte(content))))
+}
+
+func TestCappedOutput(t *testing.T) {
+	c := cappedOutput{}
+	c.Write([]byte("a\nb\n"))
+	test.Equal(t, "a\nb\n", string(c.Bytes()))
+
+	c = cappedOutput{limit: 8}
+	c.Write([]byte("1\n2\n"))
+	c.Write([]byte("3\n4\n"))
+	test.Equal(t, "1\n2\n3\n4\n", string(c.Bytes()))
+
+	// 保留开头和结尾,结尾从完整的行开始
+	c = cappedOutput{limit: 8}
+	for _, v := range []string{"1\n", "2\n", "3\n", "4\n", "5\n", "66\n", "7\n"} {
+		c.Write([]byte(v))
+	}
+	test.Equal(t, []string{
+		"1",
+		"2",
+		"[system] truncated 9 bytes",
+		"7",
+	}, lines(c.Bytes()))
+	test.Equal(t, int64(9), c.truncated)
+
+	// 开头在行中间被截断时标记另起一行
+	c = cappedOutput{limit: 4}
+	c.Write([]byte("abcdefgh\n"))
+	test.Equal(t, []string{
+		"ab",
+		"[system] truncated 7 bytes",
+	}, lines(c.Bytes()))
+}
+
+func TestCmdUint_OutputLimit(t *testing.T) {
+	cu := newTestCmd(t, "flood")
+	cu.maxOutputSize = 16
+	cu.maxLogSize = 32
+	test.Nil(t, cu.launch())
+
+	test.Equal(t, true, len(cu.content) < 17<<10)
+	l := lines(cu.content)
+	test.Equal(t, true, strings.HasPrefix(l[0], "[stderr] eee"))
+	test.Equal(t, true, strings.HasPrefix(l[len(l)-1], "["))
+	test.Equal(t, 1, strings.Count(string(cu.content), "[system "))
+
+	b, err := os.ReadFile(cu.logPath)
+	test.Nil(t, err)
+	test.Equal(t, true, len(b) < 33<<10)
+	l = lines(b)
+	test.Equal(t, true, strings.HasPrefix(l[len(l)-1], "[system] truncated "))
+}
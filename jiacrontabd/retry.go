@@ -0,0 +1,65 @@
+package jiacrontabd
+
+import (
+	"context"
+	"jiacrontab/models"
+	"math/rand"
+	"time"
+
+	"github.com/iwannay/log"
+)
+
+// waitRetry 等待第attempt次重试,执行被kill或替换时返回false
+func (j *JobEntry) waitRetry(p *process, attempt int) bool {
+	d := j.detail.RetryPolicy.NextDelay(attempt, rand.Int63n)
+	if d <= 0 {
+		return true
+	}
+	log.Infof("%s(%d) retry %d after %s", j.detail.Name, j.detail.ID, attempt, d)
+
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return true
+	case <-p.ctx.Done():
+		return false
+	}
+}
+
+// pushAttempt 记录失败后需要重试的尝试
+func (j *JobEntry) pushAttempt(p *process, err error) {
+	j.pushHistory(p, p.attemptStart, time.Now(), err)
+}
+
+// pushHistory 记录一次尝试的执行结果,同一次调度的尝试RunID相同
+func (j *JobEntry) pushHistory(p *process, startTime, endTime time.Time, err error) {
+	var errMsg string
+	if err != nil {
+		errMsg = err.Error()
+	}
+	if err := j.jd.rpcCallCtx(context.TODO(), "Srv.PushJobLog", models.JobHistory{
+		JobType:    models.JobTypeCrontab,
+		JobID:      j.detail.ID,
+		Addr:       j.jd.getOpts().BoardcastAddr,
+		JobName:    j.detail.Name,
+		StartTime:  startTime,
+		EndTime:    endTime,
+		QueueTime:  p.queueTime.Seconds(),
+		ExitMsg:    errMsg,
+		ExitStatus: j.exitStatus(p, err),
+		RunID:      p.runID,
+		Attempt:    p.retryNum + 1,
+		ExitCode:   p.usage.ExitCode,
+		Signal:     p.usage.Signal,
+		UserTime:   p.usage.UserTime.Seconds(),
+		SysTime:    p.usage.SysTime.Seconds(),
+		MaxRSS:     p.usage.MaxRSS,
+		Stop:       p.usage.Stop,
+
+		Misfire:       !j.misfire.IsZero(),
+		ScheduledTime: j.misfire,
+	}, nil); err != nil {
+		log.Error("rpc call Srv.PushJobLog failed:", err)
+	}
+}
@@ -0,0 +1,100 @@
+package jiacrontabd
+
+import (
+	"container/heap"
+	"jiacrontab/models"
+	"jiacrontab/pkg/pqueue"
+	"sync"
+)
+
+// slotWaiter 等待执行名额的job
+type slotWaiter struct {
+	entry   *JobEntry
+	ready   chan struct{}
+	granted bool
+}
+
+// slots 节点级的执行名额,超出max_concurrent_jobs的执行按优先级排队
+// 同一优先级按排队顺序执行
+type slots struct {
+	mux     sync.Mutex
+	jd      *Jiacrontabd
+	running int
+	seq     int64
+	pq      pqueue.PriorityQueue
+}
+
+func newSlots(jd *Jiacrontabd) *slots {
+	return &slots{
+		jd: jd,
+		pq: pqueue.New(100),
+	}
+}
+
+func (s *slots) max() int {
+	return s.jd.getOpts().MaxConcurrentJobs
+}
+
+// acquire 取得执行名额,job被停止时返回false
+func (s *slots) acquire(entry *JobEntry, class string) bool {
+	s.mux.Lock()
+	if max := s.max(); max <= 0 || (s.running < max && s.pq.Len() == 0) {
+		s.running++
+		s.mux.Unlock()
+		return true
+	}
+
+	w := &slotWaiter{
+		entry: entry,
+		ready: make(chan struct{}),
+	}
+	s.seq++
+	heap.Push(&s.pq, &pqueue.Item{
+		Value:    w,
+		Priority: int64(models.PriorityRank(class))<<48 | s.seq,
+	})
+	s.mux.Unlock()
+
+	<-w.ready
+	return w.granted
+}
+
+// release 归还执行名额并按优先级唤醒排队的job
+func (s *slots) release() {
+	s.mux.Lock()
+	s.running--
+	s.dispatch()
+	s.mux.Unlock()
+}
+
+// cancel 放弃entry所有排队中的执行
+func (s *slots) cancel(entry *JobEntry) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	// 逐个heap.Remove会把末尾的元素换到已检查过的位置,所以先过滤再重建堆
+	pq := s.pq[:0]
+	for _, item := range s.pq {
+		if w := item.Value.(*slotWaiter); w.entry == entry {
+			close(w.ready)
+			continue
+		}
+		item.Index = len(pq)
+		pq = append(pq, item)
+	}
+	for i := len(pq); i < len(s.pq); i++ {
+		s.pq[i] = nil
+	}
+	s.pq = pq
+	heap.Init(&s.pq)
+}
+
+// dispatch 调用方需持有s.mux
+func (s *slots) dispatch() {
+	max := s.max()
+	for s.pq.Len() > 0 && (max <= 0 || s.running < max) {
+		w := heap.Pop(&s.pq).(*pqueue.Item).Value.(*slotWaiter)
+		w.granted = true
+		s.running++
+		close(w.ready)
+	}
+}
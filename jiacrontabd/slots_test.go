@@ -0,0 +1,123 @@
+package jiacrontabd
+
+import (
+	"jiacrontab/models"
+	"jiacrontab/pkg/test"
+	"testing"
+	"time"
+)
+
+func newTestSlots(max int) *slots {
+	cfg := NewConfig()
+	cfg.MaxConcurrentJobs = max
+	return newSlots(New(cfg))
+}
+
+// waitQueued 等待排队的执行数达到n
+func waitQueued(t *testing.T, s *slots, n int) {
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		s.mux.Lock()
+		l := s.pq.Len()
+		s.mux.Unlock()
+		if l == n {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("queued %d, want %d", l, n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+type testWaiter struct {
+	name  string
+	entry *JobEntry
+	class string
+}
+
+// enqueue 按顺序排队,返回取得名额的结果
+func enqueue(t *testing.T, s *slots, waiters []testWaiter) (granted, canceled chan string) {
+	granted = make(chan string, len(waiters))
+	canceled = make(chan string, len(waiters))
+	for i, v := range waiters {
+		go func(v testWaiter) {
+			if s.acquire(v.entry, v.class) {
+				granted <- v.name
+			} else {
+				canceled <- v.name
+			}
+		}(v)
+		waitQueued(t, s, i+1)
+	}
+	return
+}
+
+// grantOrder 逐个归还名额,返回排队的执行取得名额的顺序
+func grantOrder(t *testing.T, s *slots, granted chan string, n int) []string {
+	var ret []string
+	for i := 0; i < n; i++ {
+		s.release()
+		select {
+		case name := <-granted:
+			ret = append(ret, name)
+		case <-time.After(5 * time.Second):
+			t.Fatal("no waiter granted")
+		}
+	}
+	return ret
+}
+
+func TestSlots_Priority(t *testing.T) {
+	s := newTestSlots(1)
+	test.Equal(t, true, s.acquire(&JobEntry{}, ""))
+
+	granted, _ := enqueue(t, s, []testWaiter{
+		{"low1", &JobEntry{}, models.PriorityLow},
+		{"normal1", &JobEntry{}, ""},
+		{"high1", &JobEntry{}, models.PriorityHigh},
+		{"normal2", &JobEntry{}, models.PriorityNormal},
+		{"low2", &JobEntry{}, models.PriorityLow},
+		{"high2", &JobEntry{}, models.PriorityHigh},
+	})
+	// 不同优先级按优先级执行,同一优先级按排队顺序执行
+	test.Equal(t, []string{"high1", "high2", "normal1", "normal2", "low1", "low2"}, grantOrder(t, s, granted, 6))
+}
+
+func TestSlots_Unlimited(t *testing.T) {
+	s := newTestSlots(0)
+	for i := 0; i < 3; i++ {
+		test.Equal(t, true, s.acquire(&JobEntry{}, ""))
+	}
+	test.Equal(t, 3, s.running)
+}
+
+func TestSlots_Cancel(t *testing.T) {
+	s := newTestSlots(1)
+	test.Equal(t, true, s.acquire(&JobEntry{}, ""))
+
+	// 删除第一个stopped时末尾的stopped会上浮到已检查过的位置
+	stopped := &JobEntry{}
+	waiters := []testWaiter{
+		{"high1", &JobEntry{}, models.PriorityHigh},
+		{"normal1", &JobEntry{}, models.PriorityNormal},
+		{"high2", &JobEntry{}, models.PriorityHigh},
+		{"normal2", &JobEntry{}, models.PriorityNormal},
+		{"stopped", stopped, models.PriorityNormal},
+		{"stopped", stopped, models.PriorityHigh},
+	}
+	want := []string{"high1", "high2", "normal1", "normal2"}
+
+	granted, canceled := enqueue(t, s, waiters)
+	s.cancel(stopped)
+	for i := 0; i < 2; i++ {
+		select {
+		case name := <-canceled:
+			test.Equal(t, "stopped", name)
+		case <-time.After(5 * time.Second):
+			t.Fatal("stopped waiter not canceled")
+		}
+	}
+	waitQueued(t, s, 4)
+	test.Equal(t, want, grantOrder(t, s, granted, 4))
+}
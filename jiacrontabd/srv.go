@@ -84,7 +84,28 @@ func (j *CrontabJob) List(args proto.QueryJobArgs, reply *proto.QueryCrontabJobR
 	reply.Page = args.Page
 	reply.Pagesize = args.Pagesize
 
-	return model.Order(fmt.Sprintf("created_user_id=%d desc, id desc", args.UserID)).Offset((args.Page - 1) * args.Pagesize).Limit(args.Pagesize).Find(&reply.List).Error
+	err = model.Order(fmt.Sprintf("created_user_id=%d desc, id desc", args.UserID)).Offset((args.Page - 1) * args.Pagesize).Limit(args.Pagesize).Find(&reply.List).Error
+	if err != nil {
+		return err
+	}
+
+	for k, v := range reply.List {
+		if v.NextExecTime.IsZero() {
+			continue
+		}
+		reply.List[k].NodeNextExecTime = v.NextExecTime.Local()
+		reply.List[k].ZoneNextExecTime = v.NextExecTime.Local()
+		if loc, err := crontab.LoadLocation(v.TimeArgs.Timezone); err == nil {
+			reply.List[k].ZoneNextExecTime = v.NextExecTime.In(loc)
+		}
+		// 使用调度时计算的结果,不在每次查询时重新计算
+		j.jd.mux.RLock()
+		if entry, ok := j.jd.jobs[v.ID]; ok {
+			reply.List[k].SkippedExecTimes = entry.skipped
+		}
+		j.jd.mux.RUnlock()
+	}
+	return nil
 }
 
 func (j *CrontabJob) Audit(args proto.AuditJobArgs, reply *[]models.CrontabJob) error {
@@ -115,10 +136,8 @@ func (j *CrontabJob) Edit(args proto.EditCrontabJobArgs, reply *models.CrontabJo
 	} else {
 		// we should kill the job
 		j.jd.killTask(args.Job.ID)
+		j.jd.deleteJob(args.Job.ID)
 
-		j.jd.mux.Lock()
-		delete(j.jd.jobs, args.Job.ID)
-		j.jd.mux.Unlock()
 		if args.GroupID == models.SuperGroup.ID {
 			model = model.Where("id=?", args.Job.ID)
 		} else if args.Root {
@@ -132,6 +151,8 @@ func (j *CrontabJob) Edit(args proto.EditCrontabJobArgs, reply *models.CrontabJo
 			"created_user_id", "created_username",
 			"last_cost_time", "last_exec_time", "group_id",
 			"last_exit_status", "process_num",
+			"last_queue_time", "last_exit_code", "last_signal",
+			"last_user_time", "last_sys_time", "last_max_rss",
 		).Save(&args.Job)
 	}
 	*reply = args.Job
@@ -146,7 +167,54 @@ func (j *CrontabJob) Get(args proto.GetJobArgs, reply *models.CrontabJob) error
 	} else {
 		model = model.Where("id=? and created_user_id=? and group_id=?", args.JobID, args.UserID, args.GroupID)
 	}
-	return model.Find(reply).Error
+	if err := model.Find(reply).Error; err != nil {
+		return err
+	}
+
+	j.jd.mux.RLock()
+	entry, ok := j.jd.jobs[reply.ID]
+	j.jd.mux.RUnlock()
+	if ok {
+		reply.QueuedRuns = entry.queued()
+	}
+	return nil
+}
+
+// SchedulePreview 预览定时规则接下来的执行时间
+// 定时规则错误时通过reply.Errors返回
+func (j *CrontabJob) SchedulePreview(args proto.SchedulePreviewArgs, reply *proto.SchedulePreviewReply) error {
+	job, err := j.jd.newCrontabJob(&models.CrontabJob{
+		CronExpr:  args.CronExpr,
+		TimeArgs:  args.TimeArgs,
+		Calendars: args.Calendars,
+
+		CalendarRules: args.CalendarRules,
+
+		ActiveFrom:  args.ActiveFrom,
+		ActiveUntil: args.ActiveUntil,
+
+		ScheduleType: args.ScheduleType,
+		Interval:     args.Interval,
+	})
+	if err != nil {
+		reply.Errors = append(reply.Errors, newScheduleFieldError(err))
+		return nil
+	}
+	job.ID = args.JobID
+	job.Horizon = j.jd.getOpts().ScheduleHorizon
+
+	var skipped []crontab.Skipped
+	desc, err := job.Describe()
+	if err == nil {
+		reply.Times, skipped, err = job.NextExecutionTimes(time.Now(), args.Num)
+	}
+	if err != nil {
+		reply.Errors = append(reply.Errors, newScheduleFieldError(err))
+		return nil
+	}
+	reply.Description = desc
+	reply.Skipped = newSkippedExecutions(skipped)
+	return nil
 }
 
 func (j *CrontabJob) Start(args proto.ActionJobsArgs, jobs *[]models.CrontabJob) error {
@@ -159,13 +227,13 @@ func (j *CrontabJob) Start(args proto.ActionJobsArgs, jobs *[]models.CrontabJob)
 
 	if args.GroupID == models.SuperGroup.ID {
 		model = model.Where("id in (?) and status in (?)",
-			args.JobIDs, []models.JobStatus{models.StatusJobOk, models.StatusJobStop})
+			args.JobIDs, []models.JobStatus{models.StatusJobOk, models.StatusJobStop, models.StatusJobFinished})
 	} else if args.Root {
 		model = model.Where("id in (?) and status in (?) and group_id=?",
-			args.JobIDs, []models.JobStatus{models.StatusJobOk, models.StatusJobStop}, args.GroupID)
+			args.JobIDs, []models.JobStatus{models.StatusJobOk, models.StatusJobStop, models.StatusJobFinished}, args.GroupID)
 	} else {
 		model = model.Where("created_user_id = ? and id in (?) and status in (?) and group_id=?",
-			args.UserID, args.JobIDs, []models.JobStatus{models.StatusJobOk, models.StatusJobStop}, args.GroupID)
+			args.UserID, args.JobIDs, []models.JobStatus{models.StatusJobOk, models.StatusJobStop, models.StatusJobFinished}, args.GroupID)
 	}
 
 	ret := model.Find(jobs)
@@ -173,16 +241,17 @@ func (j *CrontabJob) Start(args proto.ActionJobsArgs, jobs *[]models.CrontabJob)
 		return ret.Error
 	}
 
-	for _, v := range *jobs {
-		err := j.jd.addJob(&crontab.Job{
-			ID:      v.ID,
-			Second:  v.TimeArgs.Second,
-			Minute:  v.TimeArgs.Minute,
-			Hour:    v.TimeArgs.Hour,
-			Day:     v.TimeArgs.Day,
-			Month:   v.TimeArgs.Month,
-			Weekday: v.TimeArgs.Weekday,
-		}, false)
+	for k, v := range *jobs {
+		job, err := j.jd.newCrontabJob(&v)
+		if err != nil {
+			return err
+		}
+		err = j.jd.addJob(job, false)
+		if crontab.IsFinished(err) {
+			j.jd.deleteJob(v.ID)
+			(*jobs)[k].Status = finishedStatus(err)
+			continue
+		}
 		if err != nil {
 			return err
 		}
@@ -203,14 +272,27 @@ func (j *CrontabJob) Stop(args proto.ActionJobsArgs, jobs *[]models.CrontabJob)
 			args.UserID, args.JobIDs, []models.JobStatus{models.StatusJobTiming, models.StatusJobRunning}, args.GroupID)
 	}
 
-	for _, jobID := range args.JobIDs {
-		j.jd.killTask(jobID)
+	if err := model.Find(jobs).Error; err != nil {
+		return err
+	}
+
+	var ids []uint
+	for k, v := range *jobs {
+		j.jd.killTask(v.ID)
+		j.jd.deleteJob(v.ID)
+		ids = append(ids, v.ID)
+		(*jobs)[k].Status = models.StatusJobStop
+		(*jobs)[k].NextExecTime = time.Time{}
+	}
+
+	if len(ids) == 0 {
+		return nil
 	}
 
-	return model.Updates(map[string]interface{}{
+	return models.DB().Model(&models.CrontabJob{}).Where("id in (?)", ids).Updates(map[string]interface{}{
 		"status":         models.StatusJobStop,
 		"next_exec_time": time.Time{},
-	}).Find(jobs).Error
+	}).Error
 }
 
 func (j *CrontabJob) Delete(args proto.ActionJobsArgs, job *[]models.CrontabJob) error {
@@ -223,7 +305,14 @@ func (j *CrontabJob) Delete(args proto.ActionJobsArgs, job *[]models.CrontabJob)
 		model = model.Where("created_user_id = ? and id in (?) and group_id=?",
 			args.UserID, args.JobIDs, args.GroupID)
 	}
-	return model.Find(job).Delete(&models.CrontabJob{}).Error
+	if err := model.Find(job).Delete(&models.CrontabJob{}).Error; err != nil {
+		return err
+	}
+	for _, v := range *job {
+		j.jd.deleteJob(v.ID)
+		j.jd.cancelOneOffs(models.DB().Where("job_id=?", v.ID), "job已删除")
+	}
+	return nil
 }
 
 func (j *CrontabJob) Kill(args proto.ActionJobsArgs, job *[]models.CrontabJob) error {
@@ -305,13 +394,100 @@ func (j *CrontabJob) Exec(args proto.GetJobArgs, reply *proto.ExecCrontabJobRepl
 		defer j.jd.removeTmpJob(ins)
 		ins.once = true
 		ins.exec()
-		reply.Content = ins.GetLog()
+		reply.Content = stripStreamTags(ins.GetLog())
 	} else {
 		reply.Content = []byte(err.Error())
 	}
 	return err
 }
 
+// RunOnce 在指定时刻执行一次job,可覆盖命令、环境变量等参数
+func (j *CrontabJob) RunOnce(args proto.RunOnceArgs, reply *models.OneOffRun) error {
+	var job models.CrontabJob
+
+	model := models.DB()
+	if args.GroupID == models.SuperGroup.ID {
+		model = model.Where("id=?", args.JobID)
+	} else if args.Root {
+		model = model.Where("id=? and group_id=?", args.JobID, args.GroupID)
+	} else {
+		model = model.Where("created_user_id = ? and id=? and group_id=?", args.UserID, args.JobID, args.GroupID)
+	}
+	if err := model.Take(&job).Error; err != nil {
+		return err
+	}
+	if err := oneOffAllowed(job); err != nil {
+		return err
+	}
+
+	runAt := args.RunAt
+	if runAt.IsZero() {
+		runAt = time.Now().Add(args.Delay)
+	}
+
+	*reply = models.OneOffRun{
+		JobID:           job.ID,
+		JobName:         job.Name,
+		GroupID:         job.GroupID,
+		RunAt:           runAt,
+		Status:          models.OneOffPending,
+		Command:         args.Command,
+		Code:            args.Code,
+		WorkEnv:         args.WorkEnv,
+		WorkDir:         args.WorkDir,
+		Timeout:         args.Timeout,
+		CreatedUserID:   args.UserID,
+		CreatedUsername: args.Username,
+	}
+	if reply.Overridden() && !args.Root && args.GroupID != models.SuperGroup.ID {
+		return errors.New("only root can override command, code, workEnv or workDir")
+	}
+	if err := models.DB().Create(reply).Error; err != nil {
+		return err
+	}
+	j.jd.addOneOff(reply)
+	return nil
+}
+
+// OneOffList 一次性执行列表
+func (j *CrontabJob) OneOffList(args proto.QueryOneOffArgs, reply *proto.QueryOneOffRet) error {
+	model := models.DB().Model(&models.OneOffRun{})
+	if args.GroupID == models.SuperGroup.ID {
+	} else if args.Root {
+		model = model.Where("group_id=?", args.GroupID)
+	} else {
+		model = model.Where("created_user_id=? and group_id=?", args.UserID, args.GroupID)
+	}
+	if args.JobID != 0 {
+		model = model.Where("job_id=?", args.JobID)
+	}
+	if args.Status != "" {
+		model = model.Where("status=?", args.Status)
+	}
+
+	if err := model.Count(&reply.Total).Error; err != nil {
+		return err
+	}
+	reply.Page = args.Page
+	reply.Pagesize = args.Pagesize
+	return model.Order("run_at desc, id desc").Offset((args.Page - 1) * args.Pagesize).Limit(args.Pagesize).Find(&reply.List).Error
+}
+
+// CancelOneOffs 取消等待中的一次性执行
+func (j *CrontabJob) CancelOneOffs(args proto.CancelOneOffArgs, reply *[]models.OneOffRun) error {
+	model := models.DB()
+	if args.GroupID == models.SuperGroup.ID {
+		model = model.Where("id in (?)", args.IDs)
+	} else if args.Root {
+		model = model.Where("id in (?) and group_id=?", args.IDs, args.GroupID)
+	} else {
+		model = model.Where("created_user_id=? and id in (?) and group_id=?", args.UserID, args.IDs, args.GroupID)
+	}
+	var err error
+	*reply, err = j.jd.cancelOneOffs(model, "手动取消")
+	return err
+}
+
 func (j *CrontabJob) Log(args proto.SearchLog, reply *proto.SearchLogResult) error {
 	fd := finder.NewFinder(func(info os.FileInfo) bool {
 		basename := filepath.Base(info.Name())
@@ -332,6 +508,7 @@ func (j *CrontabJob) Log(args proto.SearchLog, reply *proto.SearchLogResult) err
 	if args.IsTail {
 		fd.SetTail(true)
 	}
+	fd.SetLinePrefix(streamPrefix(args.Stream))
 
 	rootpath := filepath.Join(j.jd.getOpts().LogPath, "crontab_task", args.Date)
 	err := fd.Search(rootpath, args.Pattern, &reply.Content, args.Offset, args.Pagesize)
@@ -550,6 +727,7 @@ func (j *DaemonJob) Log(args proto.SearchLog, reply *proto.SearchLogResult) erro
 	if args.IsTail {
 		fd.SetTail(true)
 	}
+	fd.SetLinePrefix(streamPrefix(args.Stream))
 
 	rootpath := filepath.Join(j.jd.getOpts().LogPath, "daemon_job", args.Date)
 	err := fd.Search(rootpath, args.Pattern, &reply.Content, args.Offset, args.Pagesize)
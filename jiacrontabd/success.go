@@ -0,0 +1,76 @@
+package jiacrontabd
+
+import (
+	"bytes"
+	"fmt"
+	"jiacrontab/models"
+	"regexp"
+	"time"
+
+	"github.com/iwannay/log"
+)
+
+// successChecker 按job的成功规则检查一次执行的结果
+type successChecker struct {
+	rule         models.SuccessRule
+	mustMatch    *regexp.Regexp
+	mustNotMatch *regexp.Regexp
+	matched      bool
+	unwanted     []byte // 第一个匹配MustNotMatch的行
+}
+
+func newSuccessChecker(rule models.SuccessRule) *successChecker {
+	c := &successChecker{rule: rule}
+	var err error
+	if rule.MustMatch != "" {
+		if c.mustMatch, err = regexp.Compile(rule.MustMatch); err != nil {
+			log.Error("compile mustMatch error:", err)
+		}
+	}
+	if rule.MustNotMatch != "" {
+		if c.mustNotMatch, err = regexp.Compile(rule.MustNotMatch); err != nil {
+			log.Error("compile mustNotMatch error:", err)
+		}
+	}
+	return c
+}
+
+// feed 检查一行输出
+func (c *successChecker) feed(stream string, line []byte) {
+	if !c.rule.CheckStream(stream) {
+		return
+	}
+	line = bytes.TrimRight(line, "\r\n")
+	if c.mustMatch != nil && !c.matched && c.mustMatch.Match(line) {
+		c.matched = true
+	}
+	if c.mustNotMatch != nil && c.unwanted == nil && c.mustNotMatch.Match(line) {
+		c.unwanted = append([]byte{}, line...)
+	}
+}
+
+// check 根据退出码、输出和执行时间判断执行是否成功
+// 进程未能启动或被信号结束时保留原有的错误
+func (c *successChecker) check(err error, exitCode int, cost time.Duration) error {
+	if exitCode >= 0 {
+		if c.rule.AcceptExitCode(exitCode) {
+			err = nil
+		} else if err == nil {
+			err = fmt.Errorf("exit status %d is not accepted", exitCode)
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	if c.mustMatch != nil && !c.matched {
+		return fmt.Errorf("output does not match %q", c.rule.MustMatch)
+	}
+	if c.unwanted != nil {
+		return fmt.Errorf("output matches %q: %s", c.rule.MustNotMatch, c.unwanted)
+	}
+	if max := time.Duration(c.rule.MaxDuration) * time.Second; max > 0 && cost > max {
+		return fmt.Errorf("execution took %s, exceeding max duration %s", cost.Truncate(time.Millisecond), max)
+	}
+	return nil
+}
@@ -1,6 +1,10 @@
 package jiacrontabd
 
 import (
+	"errors"
+	"jiacrontab/models"
+	"jiacrontab/pkg/crontab"
+	"jiacrontab/pkg/proto"
 	"jiacrontab/pkg/util"
 	"os"
 
@@ -10,6 +14,7 @@ import (
 	"net"
 	"strconv"
 	"strings"
+	"time"
 )
 
 func writeFile(fPath string, content *[]byte) {
@@ -22,6 +27,77 @@ func writeFile(fPath string, content *[]byte) {
 	f.Write(*content)
 }
 
+// newCrontabJob 根据数据库中的定时任务生成调度器使用的job
+// 获取不到排除日历时返回错误,避免在应排除的日期执行
+func (j *Jiacrontabd) newCrontabJob(job *models.CrontabJob) (*crontab.Job, error) {
+	calendars, err := j.calendars.get(job.Calendars, job.CalendarRules)
+	if err != nil {
+		return nil, err
+	}
+	return &crontab.Job{
+		ID:       job.ID,
+		Second:   job.TimeArgs.Second,
+		Minute:   job.TimeArgs.Minute,
+		Hour:     job.TimeArgs.Hour,
+		Day:      job.TimeArgs.Day,
+		Month:    job.TimeArgs.Month,
+		Weekday:  job.TimeArgs.Weekday,
+		Year:     job.TimeArgs.Year,
+		Expr:     job.CronExpr,
+		Timezone: job.TimeArgs.Timezone,
+
+		DSTRepeated: job.TimeArgs.DSTRepeated,
+		DSTSkipped:  job.TimeArgs.DSTSkipped,
+		Jitter:      time.Duration(job.TimeArgs.Jitter) * time.Second,
+		Spread:      time.Duration(job.TimeArgs.Spread) * time.Second,
+		Calendars:   calendars,
+		ActiveFrom:  job.ActiveFrom,
+		ActiveUntil: job.ActiveUntil,
+		Interval:    job.ScheduleInterval(),
+		FixedDelay:  job.ScheduleType == models.ScheduleFixedDelay,
+	}, nil
+}
+
+// finishedStatus 定时规则不再触发时job的状态
+func finishedStatus(err error) models.JobStatus {
+	if crontab.IsExpired(err) {
+		return models.StatusJobExpired
+	}
+	return models.StatusJobFinished
+}
+
+// newSkippedExecutions 转换因排除日历跳过的执行
+func newSkippedExecutions(list []crontab.Skipped) []models.SkippedExecution {
+	var ret []models.SkippedExecution
+	for _, v := range list {
+		ret = append(ret, models.SkippedExecution{
+			Time:     v.Time,
+			Calendar: v.Calendar,
+			Name:     v.Name,
+		})
+	}
+	return ret
+}
+
+// newScheduleFieldError 将定时规则的解析错误转换为带字段位置的错误
+func newScheduleFieldError(err error) proto.ScheduleFieldError {
+	var fe *crontab.FieldError
+	if errors.As(err, &fe) {
+		return proto.ScheduleFieldError{
+			Field:   fe.Field,
+			Value:   fe.Value,
+			Index:   fe.Index,
+			Offset:  fe.Offset,
+			Message: fe.Err.Error(),
+		}
+	}
+	return proto.ScheduleFieldError{
+		Index:   -1,
+		Offset:  -1,
+		Message: err.Error(),
+	}
+}
+
 func GetIntranetIpList() *list.List {
 	ipList := list.New()
 	addrs, err := net.InterfaceAddrs()
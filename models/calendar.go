@@ -0,0 +1,86 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Calendar 排除日历,引用该日历的定时任务在排除的日期内不执行
+type Calendar struct {
+	gorm.Model
+	Name            string        `json:"name" gorm:"not null;uniqueIndex;size:200"`
+	Description     string        `json:"description"`
+	GroupID         uint          `json:"groupID" gorm:"index"`
+	CreatedUserID   uint          `json:"createdUserID"`
+	CreatedUsername string        `json:"createdUsername"`
+	Excludes        CalendarDates `json:"excludes" gorm:"type:TEXT"`
+}
+
+// CalendarDate 排除的日期或日期范围,格式为2006-01-02,包含Start和End
+type CalendarDate struct {
+	Name  string `json:"name"`
+	Start string `json:"start"`
+	End   string `json:"end"`
+}
+
+type CalendarDates []CalendarDate
+
+func (c *CalendarDates) Scan(v interface{}) error {
+	switch val := v.(type) {
+	case string:
+		return json.Unmarshal([]byte(val), c)
+	case []byte:
+		return json.Unmarshal(val, c)
+	default:
+		return errors.New("not support")
+	}
+}
+
+func (c CalendarDates) Value() (driver.Value, error) {
+	if c == nil {
+		c = make(CalendarDates, 0)
+	}
+	bts, err := json.Marshal(c)
+	return string(bts), err
+}
+
+func (c CalendarDates) MarshalJSON() ([]byte, error) {
+	if c == nil {
+		c = make(CalendarDates, 0)
+	}
+	type m CalendarDates
+	return json.Marshal(m(c))
+}
+
+// Calendars 编辑job时随job下发到节点的排除日历
+type Calendars []Calendar
+
+func (c *Calendars) Scan(v interface{}) error {
+	switch val := v.(type) {
+	case string:
+		return json.Unmarshal([]byte(val), c)
+	case []byte:
+		return json.Unmarshal(val, c)
+	default:
+		return errors.New("not support")
+	}
+}
+
+func (c Calendars) Value() (driver.Value, error) {
+	if c == nil {
+		c = make(Calendars, 0)
+	}
+	bts, err := json.Marshal(c)
+	return string(bts), err
+}
+
+// SkippedExecution 因排除日历跳过的执行
+type SkippedExecution struct {
+	Time     time.Time `json:"time"`
+	Calendar string    `json:"calendar"`
+	Name     string    `json:"name"`
+}
@@ -0,0 +1,29 @@
+package models
+
+import (
+	"jiacrontab/pkg/test"
+	"path/filepath"
+	"testing"
+)
+
+func TestCrontabJob_CalendarRules(t *testing.T) {
+	test.Nil(t, CreateDB("sqlite3", filepath.Join(t.TempDir(), "job.db")))
+	test.Nil(t, DB().AutoMigrate(&CrontabJob{}))
+
+	job := CrontabJob{
+		Name:      "backup",
+		Calendars: UintSlice{1},
+		CalendarRules: Calendars{{
+			Name:     "holiday",
+			Excludes: CalendarDates{{Start: "2020-10-01", End: "2020-10-07"}},
+		}},
+	}
+	job.CalendarRules[0].ID = 1
+	test.Nil(t, DB().Save(&job).Error)
+
+	var got CrontabJob
+	test.Nil(t, DB().Take(&got, "id=?", job.ID).Error)
+	test.Equal(t, 1, len(got.CalendarRules))
+	test.Equal(t, uint(1), got.CalendarRules[0].ID)
+	test.Equal(t, "2020-10-07", got.CalendarRules[0].Excludes[0].End)
+}
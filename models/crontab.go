@@ -24,8 +24,67 @@ const (
 	StatusJobRunning JobStatus = 3
 	// StatusJobStop 已停止
 	StatusJobStop JobStatus = 4
+	// StatusJobFinished 已结束,定时规则不会再触发
+	StatusJobFinished JobStatus = 5
+	// StatusJobExpired 已过期,有效期内不会再触发
+	StatusJobExpired JobStatus = 6
 )
 
+// 节点停机期间错过执行时的处理策略
+const (
+	// MisfireSkip 跳过错过的执行
+	MisfireSkip = "skip"
+	// MisfireRunOnce 启动后立即补跑一次
+	MisfireRunOnce = "runOnce"
+	// MisfireRunAll 补跑每一次错过的执行,最多补跑MisfireLimit次
+	MisfireRunAll = "runAll"
+	// DefaultMisfireLimit 默认最多补跑次数
+	DefaultMisfireLimit = 10
+)
+
+// 定时任务的调度方式
+const (
+	// ScheduleCron 按cron规则调度
+	ScheduleCron = "cron"
+	// ScheduleFixedRate 按固定间隔调度,与上次执行是否结束无关
+	ScheduleFixedRate = "fixedRate"
+	// ScheduleFixedDelay 上次执行结束后间隔Interval再次执行
+	ScheduleFixedDelay = "fixedDelay"
+)
+
+// 达到最大并发数时的处理策略
+const (
+	// ConcurrencyDrop 丢弃本次执行
+	ConcurrencyDrop = "drop"
+	// ConcurrencyQueue 排队等待,最多排队MaxQueued次
+	ConcurrencyQueue = "queue"
+	// ConcurrencyReplace 结束正在执行的实例后执行
+	ConcurrencyReplace = "replace"
+	// ConcurrencySkipAlert 跳过本次执行并发送告警
+	ConcurrencySkipAlert = "skipAlert"
+	// DefaultMaxQueued 默认最多排队次数
+	DefaultMaxQueued = 10
+)
+
+// 节点执行名额不足时的优先级
+const (
+	PriorityHigh   = "high"
+	PriorityNormal = "normal"
+	PriorityLow    = "low"
+)
+
+// PriorityRank 优先级排序值,越小越先执行,未设置时按normal处理
+func PriorityRank(class string) int {
+	switch class {
+	case PriorityHigh:
+		return 0
+	case PriorityLow:
+		return 2
+	default:
+		return 1
+	}
+}
+
 type CrontabJob struct {
 	gorm.Model
 	Name                string      `json:"name" gorm:"index;not null"`
@@ -61,6 +120,53 @@ type CrontabJob struct {
 	MaxConcurrent       uint        `json:"maxConcurrent"` // 脚本最大并发量
 	TimeoutTrigger      StringSlice `json:"timeoutTrigger" gorm:"type:varchar(20)"`
 	TimeArgs            TimeArgs    `json:"timeArgs" gorm:"type:TEXT"`
+	CronExpr            string      `json:"cronExpr"`                            // cron表达式,不为空时代替TimeArgs中的定时规则
+	MisfirePolicy       string      `json:"misfirePolicy"`                       // 错过执行时的处理策略,默认skip
+	MisfireLimit        int         `json:"misfireLimit"`                        // runAll策略下最多补跑次数
+	Calendars           UintSlice   `json:"calendars" gorm:"type:varchar(1000)"` // 引用的排除日历ID
+	CalendarRules       Calendars   `json:"calendarRules" gorm:"type:TEXT"`      // 编辑时admin下发的排除日历,节点获取不到最新的日历时使用
+	ActiveFrom          time.Time   `json:"activeFrom"`                          // 有效期开始时间,为零值时不限制
+	ActiveUntil         time.Time   `json:"activeUntil"`                         // 有效期结束时间,为零值时不限制
+	ScheduleType        string      `json:"scheduleType"`                        // 调度方式,默认cron
+	Interval            int         `json:"interval"`                            // fixedRate和fixedDelay的间隔秒数
+	ConcurrencyPolicy   string      `json:"concurrencyPolicy"`                   // 达到最大并发数时的处理策略,默认drop
+	MaxQueued           int         `json:"maxQueued"`                           // queue策略下最多排队次数
+	PriorityClass       string      `json:"priorityClass"`                       // 节点执行名额不足时的优先级,默认normal
+	LastQueueTime       float64     `json:"lastQueueTime"`                       // 上次执行等待节点执行名额的秒数
+	Locks               StringSlice `json:"locks" gorm:"type:varchar(1000)"`     // 执行前需取得的命名锁,持有同名锁的job不会同时执行
+	ClusterLock         bool        `json:"clusterLock"`                         // 为true时Locks为admin仲裁的集群锁
+	RetryPolicy         RetryPolicy `json:"retryPolicy" gorm:"type:TEXT"`        // 失败重试的等待时间和重试条件
+	SuccessRule         SuccessRule `json:"successRule" gorm:"type:TEXT"`        // 判断执行是否成功的规则
+	LastExitCode        int         `json:"lastExitCode"`                        // 上次执行的退出码
+	LastSignal          string      `json:"lastSignal"`                          // 上次执行被终止的信号
+	LastUserTime        float64     `json:"lastUserTime"`                        // 上次执行的用户态CPU秒数
+	LastSysTime         float64     `json:"lastSysTime"`                         // 上次执行的内核态CPU秒数
+	LastMaxRSS          int64       `json:"lastMaxRSS"`                          // 上次执行的最大常驻内存字节数
+	StopSignal          string      `json:"stopSignal"`                          // 停止时发送给进程组的信号,默认SIGTERM
+	StopGracePeriod     int         `json:"stopGracePeriod"`                     // 发送停止信号后等待退出的秒数,超时后SIGKILL,0表示直接SIGKILL
+	Limits              ProcLimits  `json:"limits" gorm:"type:TEXT"`             // 执行进程的资源限制
+	Nice                int         `json:"nice"`                                // 执行进程的nice值,-20至19
+	IOClass             string      `json:"ioClass"`                             // 执行进程的IO调度类型,为空时不设置
+	IOPriority          int         `json:"ioPriority"`                          // IO优先级,0至7,越小越优先
+	MaxOutputSize       int         `json:"maxOutputSize"`                       // 每次执行保存并返回的输出上限(KB),0表示使用节点的设置
+	MaxLogSize          int         `json:"maxLogSize"`                          // 每次执行写入日志文件的上限(KB),0表示使用节点的设置
+
+	// ZoneNextExecTime 以job时区表示的下次执行时间,仅用于列表展示
+	ZoneNextExecTime time.Time `json:"zoneNextExecTime" gorm:"-"`
+	// NodeNextExecTime 以节点本地时区表示的下次执行时间,仅用于列表展示
+	NodeNextExecTime time.Time `json:"nodeNextExecTime" gorm:"-"`
+	// SkippedExecTimes 下次执行之前因排除日历跳过的执行,仅用于列表展示
+	SkippedExecTimes []SkippedExecution `json:"skippedExecTimes" gorm:"-"`
+	// QueuedRuns 因达到最大并发数排队等待的执行,值为入队时间,仅用于展示
+	QueuedRuns []time.Time `json:"queuedRuns" gorm:"-"`
+}
+
+// ScheduleInterval 按固定间隔调度时的间隔,cron调度时返回0
+func (job *CrontabJob) ScheduleInterval() time.Duration {
+	if job.ScheduleType != ScheduleFixedRate && job.ScheduleType != ScheduleFixedDelay {
+		return 0
+	}
+	return time.Duration(job.Interval) * time.Second
 }
 
 type StringSlice []string
@@ -92,6 +198,34 @@ func (s StringSlice) Value() (driver.Value, error) {
 	return string(bts), err
 }
 
+type UintSlice []uint
+
+func (s *UintSlice) Scan(v interface{}) error {
+	switch val := v.(type) {
+	case string:
+		return json.Unmarshal([]byte(val), s)
+	case []byte:
+		return json.Unmarshal(val, s)
+	default:
+		return errors.New("not support")
+	}
+}
+
+func (s UintSlice) MarshalJSON() ([]byte, error) {
+	if s == nil {
+		s = make(UintSlice, 0)
+	}
+	return json.Marshal([]uint(s))
+}
+
+func (s UintSlice) Value() (driver.Value, error) {
+	if s == nil {
+		s = make(UintSlice, 0)
+	}
+	bts, err := json.Marshal([]uint(s))
+	return string(bts), err
+}
+
 type DependJobs []DependJob
 
 func (d *DependJobs) Scan(v interface{}) error {
@@ -135,6 +269,18 @@ type TimeArgs struct {
 	Hour    string `json:"hour"`
 	Minute  string `json:"minute"`
 	Second  string `json:"second"`
+	// Year 可选的年字段,为空时不限制年份
+	Year string `json:"year"`
+	// Timezone IANA时区,为空时按节点本地时区调度
+	Timezone string `json:"timezone"`
+	// DSTRepeated 时钟回拨时重复时刻的处理策略(once|twice)
+	DSTRepeated string `json:"dstRepeated"`
+	// DSTSkipped 时钟拨快时不存在时刻的处理策略(firstValid|skip)
+	DSTSkipped string `json:"dstSkipped"`
+	// Jitter 每次执行前的随机延迟上限(秒)
+	Jitter int `json:"jitter"`
+	// Spread 按job ID在该窗口(秒)内固定推迟执行,用于错开同一时刻的job
+	Spread int `json:"spread"`
 }
 
 func (c *TimeArgs) Scan(v interface{}) error {
@@ -30,4 +30,14 @@ type DaemonJob struct {
 	CreatedUsername string      `json:"createdUsername"`
 	UpdatedUserID   uint        `json:"updatedUserID"`
 	UpdatedUsername string      `json:"updatedUsername"`
+	Locks           StringSlice `json:"locks" gorm:"type:varchar(1000)"` // 每次启动进程前需取得的命名锁
+	ClusterLock     bool        `json:"clusterLock"`                     // 为true时Locks为admin仲裁的集群锁
+	SuccessRule     SuccessRule `json:"successRule" gorm:"type:TEXT"`    // 判断进程退出是否为成功的规则
+	StopSignal      string      `json:"stopSignal"`                      // 停止时发送给进程组的信号,默认SIGTERM
+	StopGracePeriod int         `json:"stopGracePeriod"`                 // 发送停止信号后等待退出的秒数,超时后SIGKILL,0表示直接SIGKILL
+	Limits          ProcLimits  `json:"limits" gorm:"type:TEXT"`         // 进程的资源限制
+	Nice            int         `json:"nice"`                            // 进程的nice值,-20至19
+	IOClass         string      `json:"ioClass"`                         // 进程的IO调度类型,为空时不设置
+	IOPriority      int         `json:"ioPriority"`                      // IO优先级,0至7,越小越优先
+	MaxLogSize      int         `json:"maxLogSize"`                      // 每次启动写入日志文件的上限(KB),0表示使用节点的设置
 }
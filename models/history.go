@@ -23,6 +23,26 @@ type JobHistory struct {
 	ExitMsg   string    `json:"exitMsg"`
 	StartTime time.Time `json:"StartTime"`
 	EndTime   time.Time `json:"endTime"`
+	// Misfire 是否为节点重启后对错过执行的补跑或跳过记录
+	Misfire bool `json:"misfire"`
+	// ScheduledTime 原定执行时刻,仅Misfire为true时有效
+	ScheduledTime time.Time `json:"scheduledTime"`
+	// ExitStatus 执行结果,例如Success、Error,未执行时为Dropped、Replaced等
+	ExitStatus string `json:"exitStatus"`
+	// QueueTime 等待节点执行名额的秒数,不计入StartTime至EndTime
+	QueueTime float64 `json:"queueTime"`
+	// RunID 同一次调度的各次尝试RunID相同,Attempt从1开始
+	RunID   string `json:"runID" gorm:"index"`
+	Attempt int    `json:"attempt"`
+	// ExitCode 进程的退出码,未启动或被信号终止时为-1,Signal为终止进程的信号
+	ExitCode int    `json:"exitCode"`
+	Signal   string `json:"signal"`
+	// UserTime、SysTime 用户态和内核态CPU秒数,MaxRSS 最大常驻内存字节数
+	UserTime float64 `json:"userTime"`
+	SysTime  float64 `json:"sysTime"`
+	MaxRSS   int64   `json:"maxRSS"`
+	// Stop 被停止时的结果,graceful为收到停止信号后自行退出,forceKilled为被SIGKILL
+	Stop string `json:"stop"`
 }
 
 func PushJobHistory(job *JobHistory) {
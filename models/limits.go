@@ -0,0 +1,53 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+)
+
+// 进程的IO调度类型
+const (
+	// IOClassRealtime 实时,需要root权限
+	IOClassRealtime = "realtime"
+	// IOClassBestEffort 尽力而为,linux的默认类型
+	IOClassBestEffort = "best-effort"
+	// IOClassIdle 仅在磁盘空闲时执行IO
+	IOClassIdle = "idle"
+)
+
+// ProcLimits 执行进程的资源限制,为0的项不限制,仅linux节点生效
+// Memory、CPU、Pids需要节点启用cgroup v2
+type ProcLimits struct {
+	AddressSpace int64   `json:"addressSpace"` // 虚拟内存上限(RLIMIT_AS),单位MB
+	OpenFiles    int64   `json:"openFiles"`    // 打开文件数上限(RLIMIT_NOFILE)
+	Processes    int64   `json:"processes"`    // 执行用户的进程数上限(RLIMIT_NPROC)
+	Memory       int64   `json:"memory"`       // cgroup内存上限(memory.max),单位MB,超出时进程被OOM结束
+	CPU          float64 `json:"cpu"`          // cgroup可使用的CPU核数(cpu.max)
+	Pids         int64   `json:"pids"`         // cgroup进程数上限(pids.max)
+}
+
+func (r *ProcLimits) Scan(v interface{}) error {
+	switch val := v.(type) {
+	case string:
+		return json.Unmarshal([]byte(val), r)
+	case []byte:
+		return json.Unmarshal(val, r)
+	default:
+		return errors.New("not support")
+	}
+}
+
+func (r ProcLimits) Value() (driver.Value, error) {
+	bts, err := json.Marshal(r)
+	return string(bts), err
+}
+
+// Validate 检查资源限制的取值
+func (r ProcLimits) Validate() error {
+	if r.AddressSpace < 0 || r.OpenFiles < 0 || r.Processes < 0 ||
+		r.Memory < 0 || r.CPU < 0 || r.Pids < 0 {
+		return errors.New("资源限制不能小于0")
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package models
+
+import (
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Lock 集群范围的命名锁,由admin仲裁
+// 持有锁的执行期间由节点定期续约,执行结束或节点停止后租约到期自动释放
+type Lock struct {
+	Name      string    `json:"name" gorm:"primaryKey"`
+	Addr      string    `json:"addr" gorm:"index"`
+	Holder    string    `json:"holder"`
+	Lease     int       `json:"lease"` // 租约秒数
+	ExpiresAt time.Time `json:"expiresAt"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// lockMux 保证检查和写入锁之间没有其他节点取得锁
+var lockMux sync.Mutex
+
+// AcquireLocks 取得全部names对应的锁,任一锁被其他持有者占用时都不取得
+// 持有者再次取得已持有的锁时续约
+func AcquireLocks(addr, holder string, names []string, lease int) (bool, error) {
+	lockMux.Lock()
+	defer lockMux.Unlock()
+
+	var acquired bool
+	now := time.Now()
+	err := DB().Transaction(func(tx *gorm.DB) error {
+		var locks []Lock
+		if err := tx.Where("name in (?)", names).Find(&locks).Error; err != nil {
+			return err
+		}
+		for _, v := range locks {
+			if v.ExpiresAt.After(now) && (v.Addr != addr || v.Holder != holder) {
+				return nil
+			}
+		}
+		for _, name := range names {
+			if err := tx.Save(&Lock{
+				Name:      name,
+				Addr:      addr,
+				Holder:    holder,
+				Lease:     lease,
+				ExpiresAt: now.Add(time.Duration(lease) * time.Second),
+				CreatedAt: now,
+			}).Error; err != nil {
+				return err
+			}
+		}
+		acquired = true
+		return nil
+	})
+	return acquired, err
+}
+
+// ReleaseLocks 释放holder持有的锁,holder为空时释放节点持有的全部锁
+func ReleaseLocks(addr, holder string, names []string) error {
+	model := DB().Where("addr=?", addr)
+	if holder != "" {
+		model = model.Where("holder=? and name in (?)", holder, names)
+	}
+	return model.Delete(&Lock{}).Error
+}
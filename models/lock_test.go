@@ -0,0 +1,47 @@
+package models
+
+import (
+	"jiacrontab/pkg/test"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestAcquireLocks(t *testing.T) {
+	test.Nil(t, CreateDB("sqlite3", filepath.Join(t.TempDir(), "lock.db")))
+	test.Nil(t, DB().AutoMigrate(&Lock{}))
+
+	ok, err := AcquireLocks("node1", "backup", []string{"db"}, 30)
+	test.Nil(t, err)
+	test.Equal(t, true, ok)
+
+	// 同名锁被其他持有者占用
+	ok, err = AcquireLocks("node2", "vacuum", []string{"db", "disk"}, 30)
+	test.Nil(t, err)
+	test.Equal(t, false, ok)
+
+	test.Nil(t, ReleaseLocks("node1", "backup", []string{"db"}))
+	ok, err = AcquireLocks("node2", "vacuum", []string{"db", "disk"}, 30)
+	test.Nil(t, err)
+	test.Equal(t, true, ok)
+
+	// 持有者再次取得时续约
+	test.Nil(t, DB().Model(&Lock{}).Where("addr=?", "node2").Update("expires_at", time.Now().Add(time.Second)).Error)
+	ok, err = AcquireLocks("node2", "vacuum", []string{"db", "disk"}, 30)
+	test.Nil(t, err)
+	test.Equal(t, true, ok)
+	var lock Lock
+	test.Nil(t, DB().Take(&lock, "name=?", "db").Error)
+	test.Equal(t, true, lock.ExpiresAt.After(time.Now().Add(20*time.Second)))
+
+	// 租约到期后可被其他节点取得
+	test.Nil(t, DB().Model(&Lock{}).Where("addr=?", "node2").Update("expires_at", time.Now().Add(-time.Second)).Error)
+	ok, err = AcquireLocks("node1", "backup", []string{"db"}, 30)
+	test.Nil(t, err)
+	test.Equal(t, true, ok)
+
+	test.Nil(t, ReleaseLocks("node1", "", nil))
+	var count int64
+	test.Nil(t, DB().Model(&Lock{}).Where("addr=?", "node1").Count(&count).Error)
+	test.Equal(t, int64(0), count)
+}
@@ -0,0 +1,67 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 一次性执行的状态
+const (
+	// OneOffPending 等待执行
+	OneOffPending = "pending"
+	// OneOffRunning 执行中
+	OneOffRunning = "running"
+	// OneOffSucceeded 执行成功
+	OneOffSucceeded = "succeeded"
+	// OneOffFailed 执行失败
+	OneOffFailed = "failed"
+	// OneOffCanceled 已取消
+	OneOffCanceled = "canceled"
+)
+
+// OneOffRun 在指定时刻执行一次的定时任务,保存在节点数据库中
+// Command、Code、WorkDir、Timeout不为零值时覆盖job的配置,WorkEnv追加到job的环境变量之后
+type OneOffRun struct {
+	gorm.Model
+	JobID           uint        `json:"jobID" gorm:"index"`
+	JobName         string      `json:"jobName"`
+	GroupID         uint        `json:"groupID" gorm:"index"`
+	RunAt           time.Time   `json:"runAt"`
+	Status          string      `json:"status" gorm:"index"`
+	Command         StringSlice `json:"command" gorm:"type:varchar(1000)"`
+	Code            string      `json:"code" gorm:"type:TEXT"`
+	WorkEnv         StringSlice `json:"workEnv" gorm:"type:varchar(1000)"`
+	WorkDir         string      `json:"workDir"`
+	Timeout         int         `json:"timeout"`
+	CreatedUserID   uint        `json:"createdUserId"`
+	CreatedUsername string      `json:"createdUsername"`
+	StartTime       time.Time   `json:"startTime"`
+	EndTime         time.Time   `json:"endTime"`
+	ExitMsg         string      `json:"exitMsg"`
+}
+
+// Overridden 判断是否覆盖了job的命令、环境变量或工作目录
+// 覆盖后会以job的执行用户执行新的命令,只允许管理员使用
+func (o *OneOffRun) Overridden() bool {
+	return len(o.Command) > 0 || o.Code != "" || len(o.WorkEnv) > 0 || o.WorkDir != ""
+}
+
+// Override 用一次性执行的参数覆盖job的配置
+func (o *OneOffRun) Override(job *CrontabJob) {
+	if len(o.Command) > 0 {
+		job.Command = o.Command
+		job.Code = o.Code
+	} else if o.Code != "" {
+		job.Code = o.Code
+	}
+	if len(o.WorkEnv) > 0 {
+		job.WorkEnv = append(append(StringSlice{}, job.WorkEnv...), o.WorkEnv...)
+	}
+	if o.WorkDir != "" {
+		job.WorkDir = o.WorkDir
+	}
+	if o.Timeout > 0 {
+		job.Timeout = o.Timeout
+	}
+}
@@ -0,0 +1,36 @@
+package models
+
+import (
+	"jiacrontab/pkg/test"
+	"testing"
+)
+
+func TestOneOffRun_Override(t *testing.T) {
+	job := CrontabJob{
+		Command: StringSlice{"sh", "-c"},
+		Code:    "echo job",
+		WorkEnv: StringSlice{"A=1"},
+		WorkDir: "/tmp",
+		Timeout: 10,
+	}
+
+	(&OneOffRun{Code: "echo once", WorkEnv: StringSlice{"B=2"}}).Override(&job)
+	test.Equal(t, StringSlice{"sh", "-c"}, job.Command)
+	test.Equal(t, "echo once", job.Code)
+	test.Equal(t, StringSlice{"A=1", "B=2"}, job.WorkEnv)
+	test.Equal(t, "/tmp", job.WorkDir)
+	test.Equal(t, 10, job.Timeout)
+
+	// 覆盖命令时不再使用job的代码
+	(&OneOffRun{Command: StringSlice{"date"}, Timeout: 5}).Override(&job)
+	test.Equal(t, StringSlice{"date"}, job.Command)
+	test.Equal(t, "", job.Code)
+	test.Equal(t, 5, job.Timeout)
+}
+
+func TestOneOffRun_Overridden(t *testing.T) {
+	test.Equal(t, false, (&OneOffRun{Timeout: 10}).Overridden())
+	test.Equal(t, true, (&OneOffRun{Code: "echo once"}).Overridden())
+	test.Equal(t, true, (&OneOffRun{WorkEnv: StringSlice{"A=1"}}).Overridden())
+	test.Equal(t, true, (&OneOffRun{WorkDir: "/tmp"}).Overridden())
+}
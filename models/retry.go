@@ -0,0 +1,92 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"math"
+	"regexp"
+	"time"
+)
+
+// RetryPolicy 失败重试的等待时间和重试条件,最多重试次数仍由RetryNum设置
+// 未设置任何重试条件时任何失败都会重试
+type RetryPolicy struct {
+	Delay         int     `json:"delay"`         // 首次重试前等待的秒数
+	Backoff       float64 `json:"backoff"`       // 每次重试等待时间的倍数,大于1时指数退避
+	MaxDelay      int     `json:"maxDelay"`      // 等待时间上限秒数,0表示不限制
+	Jitter        int     `json:"jitter"`        // 在等待时间上随机增加0至Jitter秒
+	ExitCodes     []int   `json:"exitCodes"`     // 退出码为其中之一时重试
+	OnTimeout     bool    `json:"onTimeout"`     // 执行超时时重试
+	StderrPattern string  `json:"stderrPattern"` // stderr匹配该正则时重试
+}
+
+func (r *RetryPolicy) Scan(v interface{}) error {
+	switch val := v.(type) {
+	case string:
+		return json.Unmarshal([]byte(val), r)
+	case []byte:
+		return json.Unmarshal(val, r)
+	default:
+		return errors.New("not support")
+	}
+}
+
+func (r RetryPolicy) Value() (driver.Value, error) {
+	bts, err := json.Marshal(r)
+	return string(bts), err
+}
+
+// Validate 检查重试策略的取值
+func (r RetryPolicy) Validate() error {
+	if r.Delay < 0 || r.MaxDelay < 0 || r.Jitter < 0 {
+		return errors.New("delay/maxDelay/jitter不能小于0")
+	}
+	if r.Backoff != 0 && r.Backoff < 1 {
+		return errors.New("backoff不能小于1")
+	}
+	if r.StderrPattern != "" {
+		if _, err := regexp.Compile(r.StderrPattern); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// NextDelay 第attempt次重试(从1开始)前等待的时间
+// random返回[0,n)之间的随机数
+func (r RetryPolicy) NextDelay(attempt int, random func(n int64) int64) time.Duration {
+	delay := float64(r.Delay)
+	if r.Backoff > 1 && attempt > 1 {
+		delay *= math.Pow(r.Backoff, float64(attempt-1))
+	}
+	if r.MaxDelay > 0 && delay > float64(r.MaxDelay) {
+		delay = float64(r.MaxDelay)
+	}
+	d := time.Duration(delay * float64(time.Second))
+	if r.Jitter > 0 {
+		d += time.Duration(random(int64(r.Jitter) * int64(time.Second)))
+	}
+	return d
+}
+
+// ShouldRetry 根据本次执行的退出码、是否超时和stderr判断是否需要重试
+func (r RetryPolicy) ShouldRetry(exitCode int, timeout bool, stderr []byte) bool {
+	if len(r.ExitCodes) == 0 && !r.OnTimeout && r.StderrPattern == "" {
+		return true
+	}
+	if r.OnTimeout && timeout {
+		return true
+	}
+	for _, v := range r.ExitCodes {
+		if v == exitCode {
+			return true
+		}
+	}
+	if r.StderrPattern != "" {
+		if re, err := regexp.Compile(r.StderrPattern); err == nil && re.Match(stderr) {
+			return true
+		}
+	}
+	return false
+}
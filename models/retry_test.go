@@ -0,0 +1,45 @@
+package models
+
+import (
+	"jiacrontab/pkg/test"
+	"testing"
+	"time"
+)
+
+func TestRetryPolicy_NextDelay(t *testing.T) {
+	noRandom := func(n int64) int64 { return 0 }
+
+	r := RetryPolicy{Delay: 2, Backoff: 2, MaxDelay: 10}
+	test.Equal(t, 2*time.Second, r.NextDelay(1, noRandom))
+	test.Equal(t, 4*time.Second, r.NextDelay(2, noRandom))
+	test.Equal(t, 8*time.Second, r.NextDelay(3, noRandom))
+	test.Equal(t, 10*time.Second, r.NextDelay(4, noRandom))
+
+	// 未设置退避时每次等待相同时间
+	r = RetryPolicy{Delay: 3}
+	test.Equal(t, 3*time.Second, r.NextDelay(5, noRandom))
+
+	r = RetryPolicy{Delay: 1, Jitter: 2}
+	test.Equal(t, 2*time.Second, r.NextDelay(1, func(n int64) int64 {
+		test.Equal(t, int64(2*time.Second), n)
+		return n / 2
+	}))
+}
+
+func TestRetryPolicy_ShouldRetry(t *testing.T) {
+	test.Equal(t, true, RetryPolicy{}.ShouldRetry(1, false, nil))
+
+	r := RetryPolicy{ExitCodes: []int{75}, OnTimeout: true, StderrPattern: "connection (refused|reset)"}
+	test.Equal(t, true, r.ShouldRetry(75, false, nil))
+	test.Equal(t, false, r.ShouldRetry(1, false, nil))
+	test.Equal(t, true, r.ShouldRetry(-1, true, nil))
+	test.Equal(t, true, r.ShouldRetry(1, false, []byte("dial tcp: connection refused")))
+	test.Equal(t, false, r.ShouldRetry(1, false, []byte("permission denied")))
+}
+
+func TestRetryPolicy_Validate(t *testing.T) {
+	test.Nil(t, RetryPolicy{Delay: 1, Backoff: 1.5}.Validate())
+	test.NotNil(t, RetryPolicy{Backoff: 0.5}.Validate())
+	test.NotNil(t, RetryPolicy{Delay: -1}.Validate())
+	test.NotNil(t, RetryPolicy{StderrPattern: "("}.Validate())
+}
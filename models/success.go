@@ -0,0 +1,83 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"regexp"
+)
+
+// 执行日志中每行所属的输出流
+const (
+	// StreamStdout 标准输出
+	StreamStdout = "stdout"
+	// StreamStderr 标准错误
+	StreamStderr = "stderr"
+	// StreamSystem jiacrontabd自身写入的日志,例如执行错误
+	StreamSystem = "system"
+)
+
+// SuccessRule 判断一次执行是否成功的规则,未设置时退出码为0即成功
+// 输出断言逐行匹配
+type SuccessRule struct {
+	ExitCodes    []int  `json:"exitCodes"`    // 视为成功的退出码,为空时只接受0
+	MustMatch    string `json:"mustMatch"`    // 输出中必须有行匹配该正则
+	MustNotMatch string `json:"mustNotMatch"` // 输出中不能有行匹配该正则
+	Stream       string `json:"stream"`       // 输出断言检查的输出流,为空时检查stdout和stderr
+	MaxDuration  int    `json:"maxDuration"`  // 执行超过该秒数视为失败,0表示不限制
+}
+
+func (r *SuccessRule) Scan(v interface{}) error {
+	switch val := v.(type) {
+	case string:
+		return json.Unmarshal([]byte(val), r)
+	case []byte:
+		return json.Unmarshal(val, r)
+	default:
+		return errors.New("not support")
+	}
+}
+
+func (r SuccessRule) Value() (driver.Value, error) {
+	bts, err := json.Marshal(r)
+	return string(bts), err
+}
+
+// Validate 检查成功规则的取值
+func (r SuccessRule) Validate() error {
+	if r.MaxDuration < 0 {
+		return errors.New("maxDuration不能小于0")
+	}
+	switch r.Stream {
+	case "", StreamStdout, StreamStderr:
+	default:
+		return errors.New("stream只能为stdout或stderr")
+	}
+	for _, v := range []string{r.MustMatch, r.MustNotMatch} {
+		if v == "" {
+			continue
+		}
+		if _, err := regexp.Compile(v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AcceptExitCode 退出码是否视为成功
+func (r SuccessRule) AcceptExitCode(code int) bool {
+	if len(r.ExitCodes) == 0 {
+		return code == 0
+	}
+	for _, v := range r.ExitCodes {
+		if v == code {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckStream 输出断言是否检查该输出流
+func (r SuccessRule) CheckStream(stream string) bool {
+	return r.Stream == "" || r.Stream == stream
+}
@@ -0,0 +1,26 @@
+package models
+
+import (
+	"jiacrontab/pkg/test"
+	"testing"
+)
+
+func TestSuccessRule_AcceptExitCode(t *testing.T) {
+	test.Equal(t, true, SuccessRule{}.AcceptExitCode(0))
+	test.Equal(t, false, SuccessRule{}.AcceptExitCode(1))
+
+	r := SuccessRule{ExitCodes: []int{0, 1}}
+	test.Equal(t, true, r.AcceptExitCode(0))
+	test.Equal(t, true, r.AcceptExitCode(1))
+	test.Equal(t, false, r.AcceptExitCode(2))
+}
+
+func TestSuccessRule_Validate(t *testing.T) {
+	test.Nil(t, SuccessRule{MustNotMatch: "(?i)error", Stream: StreamStdout, MaxDuration: 60}.Validate())
+	test.NotNil(t, SuccessRule{MustMatch: "["}.Validate())
+	test.NotNil(t, SuccessRule{Stream: "stdin"}.Validate())
+	test.NotNil(t, SuccessRule{MaxDuration: -1}.Validate())
+
+	test.Equal(t, true, SuccessRule{}.CheckStream(StreamStderr))
+	test.Equal(t, false, SuccessRule{Stream: StreamStdout}.CheckStream(StreamStderr))
+}
@@ -0,0 +1,83 @@
+package crontab
+
+import (
+	"fmt"
+	"time"
+)
+
+const dateLayout = "2006-01-02"
+
+// Date 不含时间和时区的日期,按job所属时区的墙上时间比较
+type Date struct {
+	Year  int
+	Month time.Month
+	Day   int
+}
+
+// ParseDate 解析2006-01-02格式的日期
+func ParseDate(s string) (Date, error) {
+	t, err := time.Parse(dateLayout, s)
+	if err != nil {
+		return Date{}, fmt.Errorf("Invalid date %s: %s", s, err)
+	}
+	return dateOf(t), nil
+}
+
+func dateOf(t time.Time) Date {
+	y, m, d := t.Date()
+	return Date{y, m, d}
+}
+
+func (d Date) String() string {
+	return fmt.Sprintf("%04d-%02d-%02d", d.Year, d.Month, d.Day)
+}
+
+func (d Date) key() int {
+	return d.Year*10000 + int(d.Month)*100 + d.Day
+}
+
+// DateRange 排除的日期范围,包含Start和End
+type DateRange struct {
+	Name  string
+	Start Date
+	End   Date
+}
+
+func (r DateRange) contains(d Date) bool {
+	return d.key() >= r.Start.key() && d.key() <= r.End.key()
+}
+
+// Calendar 排除日历,执行时刻所在日期落在Excludes中时跳过该次执行
+type Calendar struct {
+	ID       uint
+	Name     string
+	Excludes []DateRange
+}
+
+// Skipped 因排除日历跳过的执行时刻
+// 一个排除范围内的多次执行只记录第一次
+type Skipped struct {
+	Time     time.Time
+	Until    time.Time // 排除范围结束后的第一个时刻
+	Calendar string
+	Name     string
+}
+
+// exclude 判断t是否被排除,被排除时返回排除范围结束后的第一个时刻
+func (j *Job) exclude(t time.Time) (Skipped, bool) {
+	d := dateOf(t)
+	for _, c := range j.Calendars {
+		for _, r := range c.Excludes {
+			if !r.contains(d) {
+				continue
+			}
+			return Skipped{
+				Time:     t,
+				Until:    time.Date(r.End.Year, r.End.Month, r.End.Day+1, 0, 0, 0, 0, t.Location()),
+				Calendar: c.Name,
+				Name:     r.Name,
+			}, true
+		}
+	}
+	return Skipped{}, false
+}
@@ -0,0 +1,89 @@
+package crontab
+
+import (
+	"jiacrontab/pkg/test"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestJob_NextExecutionTimeCalendar(t *testing.T) {
+	timeLayout := "2006-01-02 15:04:05"
+	mustDate := func(s string) Date {
+		d, err := ParseDate(s)
+		test.Nil(t, err)
+		return d
+	}
+
+	holidays := &Calendar{
+		Name: "holidays",
+		Excludes: []DateRange{
+			{Name: "国庆节", Start: mustDate("2026-10-01"), End: mustDate("2026-10-07")},
+			{Name: "元旦", Start: mustDate("2027-01-01"), End: mustDate("2027-01-01")},
+		},
+	}
+
+	j := &Job{Expr: "0 0 9 * * *", Calendars: []*Calendar{holidays}}
+	next, err := j.NextExecutionTime(time.Date(2026, 9, 30, 10, 0, 0, 0, time.Local))
+	test.Nil(t, err)
+	test.Equal(t, "2026-10-08 09:00:00", next.Format(timeLayout))
+	test.Equal(t, 1, len(j.GetSkipped()))
+	test.Equal(t, "2026-10-01 09:00:00", j.GetSkipped()[0].Time.Format(timeLayout))
+	test.Equal(t, "2026-10-08 00:00:00", j.GetSkipped()[0].Until.Format(timeLayout))
+	test.Equal(t, "国庆节", j.GetSkipped()[0].Name)
+
+	next, err = j.NextExecutionTime(next)
+	test.Nil(t, err)
+	test.Equal(t, "2026-10-09 09:00:00", next.Format(timeLayout))
+	test.Equal(t, 0, len(j.GetSkipped()))
+
+	// 每秒执行的job在排除范围内不会逐秒查找
+	j = &Job{Expr: "* * * * * *", Calendars: []*Calendar{holidays}}
+	list, skipped, err := j.NextExecutionTimes(time.Date(2026, 12, 31, 23, 59, 58, 0, time.Local), 3)
+	test.Nil(t, err)
+	test.Equal(t, "2026-12-31 23:59:59", list[0].Format(timeLayout))
+	test.Equal(t, "2027-01-02 00:00:00", list[1].Format(timeLayout))
+	test.Equal(t, "2027-01-02 00:00:01", list[2].Format(timeLayout))
+	test.Equal(t, 1, len(skipped))
+	test.Equal(t, "元旦", skipped[0].Name)
+}
+
+func TestParseICS(t *testing.T) {
+	ics := strings.Join([]string{
+		"BEGIN:VCALENDAR",
+		"VERSION:2.0",
+		"BEGIN:VEVENT",
+		"DTSTART;VALUE=DATE:20261001",
+		"DTEND;VALUE=DATE:20261008",
+		"SUMMARY:National\\, Day",
+		"END:VEVENT",
+		"BEGIN:VEVENT",
+		"DTSTART;VALUE=DATE:20270101",
+		"SUMMARY:New Year's",
+		"  Day",
+		"END:VEVENT",
+		"BEGIN:VEVENT",
+		"DTSTART:20270210T090000Z",
+		"DTEND:20270211T180000Z",
+		"SUMMARY:Shutdown",
+		"END:VEVENT",
+		"END:VCALENDAR",
+	}, "\r\n")
+
+	list, err := ParseICS(strings.NewReader(ics))
+	test.Nil(t, err)
+	test.Equal(t, 3, len(list))
+
+	test.Equal(t, "National, Day", list[0].Name)
+	test.Equal(t, "2026-10-01", list[0].Start.String())
+	test.Equal(t, "2026-10-07", list[0].End.String())
+
+	test.Equal(t, "New Year's Day", list[1].Name)
+	test.Equal(t, "2027-01-01", list[1].End.String())
+
+	test.Equal(t, "2027-02-10", list[2].Start.String())
+	test.Equal(t, "2027-02-11", list[2].End.String())
+
+	_, err = ParseICS(strings.NewReader("BEGIN:VEVENT\nSUMMARY:x\nEND:VEVENT"))
+	test.NotNil(t, err)
+}
@@ -2,9 +2,10 @@ package crontab
 
 import (
 	"container/heap"
-	"errors"
+	"fmt"
 	"jiacrontab/pkg/pqueue"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -12,38 +13,132 @@ import (
 type Task = pqueue.Item
 
 type Crontab struct {
+	// scans QueueScanWorker检查堆顶的次数,放在开头保证32位平台上原子操作的对齐
+	scans uint64
 	pq    pqueue.PriorityQueue
 	mux   sync.RWMutex
 	ready chan *Task
+	// wakeup 堆顶变化时通知QueueScanWorker重新计算等待时间
+	wakeup chan struct{}
+	// jobs 以job ID索引堆中的任务,保证每个job最多只有一个任务
+	jobs map[uint]*Task
 }
 
 func New() *Crontab {
 	return &Crontab{
-		pq:    pqueue.New(10000),
-		ready: make(chan *Task, 10000),
+		pq:     pqueue.New(10000),
+		ready:  make(chan *Task, 10000),
+		wakeup: make(chan struct{}, 1),
+		jobs:   make(map[uint]*Task),
 	}
 }
 
 // AddJob 添加未经处理的job
+// 堆中已存在相同ID的job时替换原有任务
 func (c *Crontab) AddJob(j *Job) error {
+	return c.UpdateJob(j)
+}
+
+// UpdateJob 重新计算job的执行时间并替换堆中的任务
+// 无法得到下次执行时间时将job移出调度队列
+func (c *Crontab) UpdateJob(j *Job) error {
 	nt, err := j.NextExecutionTime(time.Now())
 	if err != nil {
-		return errors.New("Invalid execution time")
+		c.RemoveJob(j.ID)
+		return fmt.Errorf("Invalid execution time: %w", err)
 	}
-	c.mux.Lock()
-	heap.Push(&c.pq, &Task{
+
+	c.AddTask(&Task{
 		Priority: nt.UnixNano(),
 		Value:    j,
 	})
-	c.mux.Unlock()
 	return nil
 }
 
-// AddJob 添加延时任务
+// RemoveJob 将job移出调度队列
+func (c *Crontab) RemoveJob(id uint) bool {
+	c.mux.Lock()
+	t, ok := c.jobs[id]
+	if !ok {
+		c.mux.Unlock()
+		return false
+	}
+	delete(c.jobs, id)
+	head := t.Index == 0
+	ok = c.pq.Remove(t)
+	c.mux.Unlock()
+
+	if ok && head {
+		c.notify()
+	}
+	return ok
+}
+
+// HasJob 判断job是否在调度队列中
+func (c *Crontab) HasJob(id uint) bool {
+	c.mux.RLock()
+	_, ok := c.jobs[id]
+	c.mux.RUnlock()
+	return ok
+}
+
+// AddTask 添加延时任务
+// Value为*Job时按job ID索引,替换堆中该job原有的任务
 func (c *Crontab) AddTask(t *Task) {
 	c.mux.Lock()
+	var replaced bool
+	if j, ok := t.Value.(*Job); ok {
+		if old, ok := c.jobs[j.ID]; ok {
+			replaced = c.pq.Remove(old)
+		}
+		c.jobs[j.ID] = t
+	}
 	heap.Push(&c.pq, t)
+	head := t.Index == 0
+	c.mux.Unlock()
+	if head || replaced {
+		c.notify()
+	}
+}
+
+// RemoveTask 从调度队列中删除任务
+func (c *Crontab) RemoveTask(t *Task) bool {
+	c.mux.Lock()
+	head := t.Index == 0
+	ok := c.pq.Remove(t)
+	if ok {
+		c.forget(t)
+	}
+	c.mux.Unlock()
+	if ok && head {
+		c.notify()
+	}
+	return ok
+}
+
+// UpdateTask 原地修改任务的执行时间
+func (c *Crontab) UpdateTask(t *Task, priority int64) bool {
+	c.mux.Lock()
+	ok := c.pq.Update(t, priority)
 	c.mux.Unlock()
+	if ok {
+		c.notify()
+	}
+	return ok
+}
+
+// forget 任务出队后解除job ID索引,调用方需持有锁
+func (c *Crontab) forget(t *Task) {
+	if j, ok := t.Value.(*Job); ok && c.jobs[j.ID] == t {
+		delete(c.jobs, j.ID)
+	}
+}
+
+func (c *Crontab) notify() {
+	select {
+	case c.wakeup <- struct{}{}:
+	default:
+	}
 }
 
 func (c *Crontab) Len() int {
@@ -54,9 +149,10 @@ func (c *Crontab) Len() int {
 }
 
 func (c *Crontab) GetAllTask() []*Task {
-	c.mux.Lock()
-	list := c.pq
-	c.mux.Unlock()
+	c.mux.RLock()
+	list := make([]*Task, len(c.pq))
+	copy(list, c.pq)
+	c.mux.RUnlock()
 	return list
 }
 
@@ -64,25 +160,41 @@ func (c *Crontab) Ready() <-chan *Task {
 	return c.ready
 }
 
+// QueueScanWorker 等待至堆顶任务的执行时刻并将其放入ready
+// 队列为空时一直阻塞,直到有新任务加入或堆顶发生变化
 func (c *Crontab) QueueScanWorker() {
-	refreshTicker := time.NewTicker(20 * time.Millisecond)
+	timer := time.NewTimer(time.Hour)
+	if !timer.Stop() {
+		<-timer.C
+	}
+
 	for {
-		select {
-		case <-refreshTicker.C:
-			if len(c.pq) == 0 {
-				continue
-			}
-		start:
-			c.mux.Lock()
-			now := time.Now().UnixNano()
-			job, _ := c.pq.PeekAndShift(now)
-			c.mux.Unlock()
-			if job == nil {
-				continue
-			}
+		atomic.AddUint64(&c.scans, 1)
+		c.mux.Lock()
+		now := time.Now().UnixNano()
+		job, delta := c.pq.PeekAndShift(now)
+		if job != nil {
+			c.forget(job)
+		}
+		c.mux.Unlock()
+
+		if job != nil {
 			c.ready <- job
-			goto start
+			continue
+		}
+
+		if delta == 0 {
+			<-c.wakeup
+			continue
+		}
 
+		timer.Reset(time.Duration(delta))
+		select {
+		case <-timer.C:
+		case <-c.wakeup:
+			if !timer.Stop() {
+				<-timer.C
+			}
 		}
 	}
 }
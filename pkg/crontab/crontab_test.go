@@ -3,6 +3,8 @@ package crontab
 import (
 	"encoding/json"
 	"fmt"
+	"jiacrontab/pkg/test"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -55,3 +57,211 @@ func Test_crontab_Ready(t *testing.T) {
 
 	time.Sleep(10 * time.Second)
 }
+
+func TestCrontab_QueueScanWorkerWakeup(t *testing.T) {
+	c := New()
+	go c.QueueScanWorker()
+
+	far := &Task{Value: "far", Priority: time.Now().Add(time.Hour).UnixNano()}
+	c.AddTask(far)
+
+	// 新加入的任务早于堆顶时应立即唤醒
+	c.AddTask(&Task{Value: "near", Priority: time.Now().Add(50 * time.Millisecond).UnixNano()})
+	select {
+	case v := <-c.Ready():
+		test.Equal(t, "near", v.Value)
+	case <-time.After(time.Second):
+		t.Fatal("worker was not woken up by an earlier task")
+	}
+
+	// 原地修改执行时间
+	test.Equal(t, true, c.UpdateTask(far, time.Now().Add(50*time.Millisecond).UnixNano()))
+	select {
+	case v := <-c.Ready():
+		test.Equal(t, "far", v.Value)
+	case <-time.After(time.Second):
+		t.Fatal("worker was not woken up by an updated task")
+	}
+
+	removed := &Task{Value: "removed", Priority: time.Now().Add(50 * time.Millisecond).UnixNano()}
+	c.AddTask(removed)
+	test.Equal(t, true, c.RemoveTask(removed))
+	test.Equal(t, false, c.RemoveTask(removed))
+	test.Equal(t, 0, c.Len())
+	select {
+	case v := <-c.Ready():
+		t.Fatalf("unexpected task %v", v.Value)
+	case <-time.After(200 * time.Millisecond):
+	}
+}
+
+// waitIdle 等待worker阻塞,并确认之后不再检查堆顶,旧的实现每20ms轮询一次
+func waitIdle(t *testing.T, c *Crontab) {
+	deadline := time.Now().Add(time.Second)
+	for {
+		n := atomic.LoadUint64(&c.scans)
+		time.Sleep(20 * time.Millisecond)
+		if atomic.LoadUint64(&c.scans) == n {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("worker is polling")
+		}
+	}
+	n := atomic.LoadUint64(&c.scans)
+	time.Sleep(100 * time.Millisecond)
+	test.Equal(t, n, atomic.LoadUint64(&c.scans))
+}
+
+func TestCrontab_QueueScanWorkerIdle(t *testing.T) {
+	c := New()
+	go c.QueueScanWorker()
+
+	// 队列为空时阻塞等待新任务
+	waitIdle(t, c)
+
+	// 堆顶任务未到期时阻塞等待定时器
+	far := &Task{Value: "far", Priority: time.Now().Add(time.Hour).UnixNano()}
+	c.AddTask(far)
+	waitIdle(t, c)
+
+	test.Equal(t, true, c.RemoveTask(far))
+	waitIdle(t, c)
+}
+
+func TestCrontab_QueueScanWorkerOnTime(t *testing.T) {
+	c := New()
+	go c.QueueScanWorker()
+	c.AddTask(&Task{Value: "far", Priority: time.Now().Add(time.Hour).UnixNano()})
+	waitIdle(t, c)
+
+	// 加入堆顶的任务按时执行,不早于执行时刻也不等待原堆顶
+	for i := 0; i < 3; i++ {
+		due := time.Now().Add(100 * time.Millisecond)
+		c.AddTask(&Task{Value: i, Priority: due.UnixNano()})
+		select {
+		case v := <-c.Ready():
+			now := time.Now()
+			test.Equal(t, i, v.Value)
+			test.Equal(t, false, now.Before(due))
+			if late := now.Sub(due); late > 50*time.Millisecond {
+				t.Fatalf("task %d dispatched %v late", i, late)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("task %d was not dispatched", i)
+		}
+	}
+	test.Equal(t, 1, c.Len())
+}
+
+func TestCrontab_UpdateJob(t *testing.T) {
+	c := New()
+	job := &Job{ID: 1, Second: "0", Minute: "*", Hour: "*", Day: "*", Weekday: "*", Month: "*"}
+	test.Nil(t, c.AddJob(job))
+	test.Nil(t, c.AddJob(job))
+
+	edited := &Job{ID: 1, Second: "0", Minute: "0", Hour: "*", Day: "*", Weekday: "*", Month: "*"}
+	test.Nil(t, c.UpdateJob(edited))
+	test.Nil(t, c.AddJob(&Job{ID: 2, Second: "0", Minute: "*", Hour: "*", Day: "*", Weekday: "*", Month: "*"}))
+	test.Equal(t, 2, c.Len())
+
+	for _, v := range c.GetAllTask() {
+		if j := v.Value.(*Job); j.ID == 1 {
+			test.Equal(t, edited, j)
+			test.Equal(t, edited.GetNextExecTime().UnixNano(), v.Priority)
+		}
+	}
+
+	// 无效的时间表达式会将job移出调度队列
+	test.NotNil(t, c.UpdateJob(&Job{ID: 2, Second: "61", Minute: "*", Hour: "*", Day: "*", Weekday: "*", Month: "*"}))
+	test.Equal(t, false, c.HasJob(2))
+
+	test.Equal(t, true, c.RemoveJob(1))
+	test.Equal(t, false, c.RemoveJob(1))
+	test.Equal(t, 0, c.Len())
+}
+
+// pollingScanWorker 改为定时器唤醒前每20ms轮询一次堆顶的实现,用于基准测试对比
+func (c *Crontab) pollingScanWorker(done chan struct{}) {
+	ticker := time.NewTicker(20 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+		for {
+			atomic.AddUint64(&c.scans, 1)
+			c.mux.Lock()
+			job, _ := c.pq.PeekAndShift(time.Now().UnixNano())
+			if job != nil {
+				c.forget(job)
+			}
+			c.mux.Unlock()
+			if job == nil {
+				break
+			}
+			c.ready <- job
+		}
+	}
+}
+
+func pollingWorker(c *Crontab, b *testing.B) {
+	done := make(chan struct{})
+	b.Cleanup(func() { close(done) })
+	go c.pollingScanWorker(done)
+}
+
+func timerWorker(c *Crontab, b *testing.B) {
+	go c.QueueScanWorker()
+}
+
+// benchmarkIdle 堆顶任务未到期时worker每秒检查堆顶的次数
+func benchmarkIdle(b *testing.B, worker func(*Crontab, *testing.B)) {
+	c := New()
+	c.AddTask(&Task{Value: "far", Priority: time.Now().Add(time.Hour).UnixNano()})
+	worker(c, b)
+	time.Sleep(10 * time.Millisecond)
+
+	start := time.Now()
+	n := atomic.LoadUint64(&c.scans)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		time.Sleep(time.Millisecond)
+	}
+	b.ReportMetric(float64(atomic.LoadUint64(&c.scans)-n)/time.Since(start).Seconds(), "wakeups/s")
+}
+
+// benchmarkDispatch 新加入的堆顶任务从执行时刻到放入ready的延迟
+func benchmarkDispatch(b *testing.B, worker func(*Crontab, *testing.B)) {
+	c := New()
+	c.AddTask(&Task{Value: "far", Priority: time.Now().Add(time.Hour).UnixNano()})
+	worker(c, b)
+
+	var late time.Duration
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		due := time.Now().Add(time.Millisecond)
+		c.AddTask(&Task{Value: i, Priority: due.UnixNano()})
+		<-c.Ready()
+		late += time.Since(due)
+	}
+	b.ReportMetric(float64(late.Microseconds())/float64(b.N), "us-late/op")
+}
+
+func BenchmarkQueueScanWorkerIdle(b *testing.B) {
+	benchmarkIdle(b, timerWorker)
+}
+
+func BenchmarkPollingScanWorkerIdle(b *testing.B) {
+	benchmarkIdle(b, pollingWorker)
+}
+
+func BenchmarkQueueScanWorkerDispatch(b *testing.B) {
+	benchmarkDispatch(b, timerWorker)
+}
+
+func BenchmarkPollingScanWorkerDispatch(b *testing.B) {
+	benchmarkDispatch(b, pollingWorker)
+}
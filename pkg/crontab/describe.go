@@ -0,0 +1,167 @@
+package crontab
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+var weekdayNames = []string{"日", "一", "二", "三", "四", "五", "六"}
+
+// Describe 返回定时规则的中文描述
+// 例如"0 */5 9-17 * * 1-5"描述为"周一至周五 9点至17点 每5分钟 0秒"
+func (j *Job) Describe() (string, error) {
+	if err := j.parse(); err != nil {
+		return "", err
+	}
+
+	var parts []string
+	if j.every > 0 && j.FixedDelay {
+		parts = append(parts, "每次执行结束后间隔"+j.every.String())
+	} else if j.every > 0 {
+		parts = append(parts, "每隔"+j.every.String())
+	} else {
+		e, _ := j.expression()
+		parts = j.describeExpression(e)
+	}
+
+	desc := strings.Join(parts, " ")
+	if j.Timezone != "" {
+		desc += fmt.Sprintf("(时区%s)", j.Timezone)
+	}
+	if j.Spread > 0 {
+		desc += fmt.Sprintf(",按ID推迟0至%s", j.Spread)
+	}
+	if j.Jitter > 0 {
+		desc += fmt.Sprintf(",随机延迟0至%s", j.Jitter)
+	}
+	return desc, nil
+}
+
+func (j *Job) describeExpression(e expression) []string {
+	var parts []string
+
+	if s, star := describeField(e.year, years, "%d年", "年"); !star {
+		parts = append(parts, s)
+	}
+	if s, star := describeField(e.month, months, "%d月", "个月"); !star {
+		parts = append(parts, s)
+	}
+
+	day, dayStar := describeDayOfMonth(e.day)
+	weekday, weekdayStar := describeDayOfWeek(e.weekday)
+	switch {
+	case dayStar && weekdayStar:
+		parts = append(parts, "每天")
+	case dayStar:
+		parts = append(parts, weekday)
+	case weekdayStar:
+		parts = append(parts, day)
+	default:
+		parts = append(parts, day+"或"+weekday)
+	}
+
+	// 时分秒字段为*且更小的字段也为*时省略,例如"* * * * * *"描述为"每天 每秒"
+	type timeField struct {
+		field, format, unit string
+		r                   bounds
+	}
+	fields := []timeField{
+		{e.hour, "%d点", "小时", hours},
+		{e.minute, "%d分", "分钟", minutes},
+		{e.second, "%d秒", "秒", seconds},
+	}
+	for i, f := range fields {
+		s, star := describeField(f.field, f.r, f.format, f.unit)
+		if !star {
+			parts = append(parts, s)
+			continue
+		}
+		if i == len(fields)-1 {
+			parts = append(parts, "每"+f.unit)
+			continue
+		}
+		if _, lowerStar := describeField(fields[i+1].field, fields[i+1].r, "", ""); !lowerStar {
+			parts = append(parts, "每"+f.unit)
+		}
+	}
+	return parts
+}
+
+// describeField 描述常规字段,字段不限制取值时star为true
+func describeField(field string, r bounds, format, unit string) (desc string, star bool) {
+	return describeRanges(field, r, func(v uint) string { return fmt.Sprintf(format, v) }, unit)
+}
+
+func describeRanges(field string, r bounds, name func(uint) string, unit string) (desc string, star bool) {
+	if field == "" || field == "*" || field == "?" {
+		return "", true
+	}
+
+	var items []string
+	for _, expr := range strings.Split(field, ",") {
+		start, end, step, isStar, err := parseRange(expr, r)
+		if err != nil {
+			items = append(items, expr)
+			continue
+		}
+		switch {
+		case isStar && step == 1:
+			return "", true
+		case isStar:
+			items = append(items, fmt.Sprintf("每%d%s", step, unit))
+		case start == end:
+			items = append(items, name(start))
+		case step == 1:
+			items = append(items, name(start)+"至"+name(end))
+		default:
+			items = append(items, fmt.Sprintf("%s至%s每%d%s", name(start), name(end), step, unit))
+		}
+	}
+	return strings.Join(items, "、"), false
+}
+
+func describeDayOfMonth(field string) (string, bool) {
+	_, spec, err := parseDayOfMonth(field)
+	if err != nil || spec == nil {
+		return describeField(field, dom, "%d日", "天")
+	}
+	switch spec.kind {
+	case domLast:
+		if spec.day == 0 {
+			return "每月最后一天", false
+		}
+		return fmt.Sprintf("每月倒数第%d天", spec.day+1), false
+	case domLastWeekday:
+		return "每月最后一个工作日", false
+	default:
+		return fmt.Sprintf("离%d日最近的工作日", spec.day), false
+	}
+}
+
+func describeDayOfWeek(field string) (string, bool) {
+	name := func(v uint) string { return "周" + weekdayNames[v%7] }
+
+	var items []string
+	for _, expr := range strings.Split(field, ",") {
+		_, specs, err := parseDayOfWeek(expr)
+		if strings.EqualFold(expr, "L") {
+			items = append(items, name(uint(time.Saturday)))
+			continue
+		}
+		if err != nil || len(specs) == 0 {
+			s, star := describeRanges(expr, dow, name, "天")
+			if star {
+				return "", true
+			}
+			items = append(items, s)
+			continue
+		}
+		if specs[0].nth == 0 {
+			items = append(items, "最后一个"+name(specs[0].weekday))
+		} else {
+			items = append(items, fmt.Sprintf("第%d个%s", specs[0].nth, name(specs[0].weekday)))
+		}
+	}
+	return strings.Join(items, "、"), false
+}
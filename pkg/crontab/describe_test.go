@@ -0,0 +1,70 @@
+package crontab
+
+import (
+	"errors"
+	"jiacrontab/pkg/test"
+	"testing"
+	"time"
+)
+
+func TestJob_Describe(t *testing.T) {
+	cases := []struct {
+		job  *Job
+		desc string
+	}{
+		{&Job{Expr: "0 */5 9-17 * * 1-5"}, "周一至周五 9点至17点 每5分钟 0秒"},
+		{&Job{Expr: "@daily"}, "每天 0点 0分 0秒"},
+		{&Job{Expr: "* * * * * *"}, "每天 每秒"},
+		{&Job{Expr: "0 0 * * * *"}, "每天 每小时 0分 0秒"},
+		{&Job{Expr: "0 30 2 L * *"}, "每月最后一天 2点 30分 0秒"},
+		{&Job{Expr: "0 0 8 * * 1#2,FRIL"}, "第2个周一、最后一个周五 8点 0分 0秒"},
+		{&Job{Expr: "0 0 8 ? * 1,L"}, "周一、周六 8点 0分 0秒"},
+		{&Job{Expr: "0 0 0 1 1,6 * 2027"}, "2027年 1月、6月 1日 0点 0分 0秒"},
+		{&Job{Expr: "@every 90s", Timezone: "UTC"}, "每隔1m30s(时区UTC)"},
+		{&Job{Interval: 5 * time.Minute, FixedDelay: true}, "每次执行结束后间隔5m0s"},
+		{&Job{Second: "0", Minute: "0", Hour: "0", Day: "15W", Weekday: "*", Month: "*", Spread: time.Hour}, "离15日最近的工作日 0点 0分 0秒,按ID推迟0至1h0m0s"},
+	}
+
+	for _, c := range cases {
+		desc, err := c.job.Describe()
+		test.Nil(t, err)
+		test.Equal(t, c.desc, desc)
+	}
+}
+
+func TestJob_FieldError(t *testing.T) {
+	cases := []struct {
+		job           *Job
+		field         string
+		index, offset int
+	}{
+		{&Job{Expr: "0  61 * * * *"}, FieldMinute, 1, 3},
+		{&Job{Expr: "*/5 25 * * *"}, FieldHour, 1, 4},
+		{&Job{Expr: "0 0 0 * * * 1900"}, FieldYear, 6, 12},
+		{&Job{Expr: "0 0 0 * *"}, FieldDay, 2, 4},
+		{&Job{Expr: "@every 1ms"}, FieldExpr, -1, -1},
+		{&Job{Second: "0", Minute: "0", Hour: "0", Day: "32", Weekday: "*", Month: "*"}, FieldDay, -1, -1},
+		{&Job{Expr: "@daily", Timezone: "Mars/Olympus"}, FieldTimezone, -1, -1},
+	}
+
+	for _, c := range cases {
+		err := c.job.Validate()
+		var fe *FieldError
+		test.Equal(t, true, errors.As(err, &fe))
+		if fe == nil {
+			continue
+		}
+		test.Equal(t, c.field, fe.Field)
+		test.Equal(t, c.index, fe.Index)
+		test.Equal(t, c.offset, fe.Offset)
+	}
+}
+
+func TestJob_NextExecutionTimes(t *testing.T) {
+	start := time.Date(2026, 10, 18, 0, 0, 0, 0, time.Local)
+	j := &Job{Expr: "0 0 0 1 1 * 2027-2029"}
+	list, _, err := j.NextExecutionTimes(start, 5)
+	test.Nil(t, err)
+	test.Equal(t, 3, len(list))
+	test.Equal(t, time.Date(2029, 1, 1, 0, 0, 0, 0, time.Local), list[2])
+}
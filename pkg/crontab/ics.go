@@ -0,0 +1,111 @@
+package crontab
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// ParseICS 从iCalendar(.ics)文件中读取VEVENT作为排除的日期范围
+// 仅使用DTSTART、DTEND和SUMMARY,全天事件的DTEND不包含在范围内,
+// 不支持RRULE等重复规则
+func ParseICS(r io.Reader) ([]DateRange, error) {
+	var (
+		lines   []string
+		list    []DateRange
+		event   map[string]string
+		scanner = bufio.NewScanner(r)
+	)
+
+	// 以空格或制表符开头的行是上一行的延续
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if len(lines) > 0 && (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		lines = append(lines, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	for i, line := range lines {
+		colon := strings.Index(line, ":")
+		if colon < 0 {
+			continue
+		}
+		name, value := strings.ToUpper(line[:colon]), line[colon+1:]
+		if semicolon := strings.Index(name, ";"); semicolon >= 0 {
+			name = name[:semicolon]
+		}
+
+		switch {
+		case name == "BEGIN" && strings.EqualFold(value, "VEVENT"):
+			event = make(map[string]string)
+		case name == "END" && strings.EqualFold(value, "VEVENT"):
+			if event == nil {
+				return nil, fmt.Errorf("Unexpected END:VEVENT at line %d", i+1)
+			}
+			r, err := icsEvent(event)
+			if err != nil {
+				return nil, fmt.Errorf("Invalid VEVENT ending at line %d: %s", i+1, err)
+			}
+			list = append(list, r)
+			event = nil
+		case event != nil:
+			event[name] = value
+		}
+	}
+	return list, nil
+}
+
+func icsEvent(event map[string]string) (DateRange, error) {
+	var r DateRange
+	dtstart, ok := event["DTSTART"]
+	if !ok {
+		return r, fmt.Errorf("missing DTSTART")
+	}
+
+	start, _, err := icsDate(dtstart)
+	if err != nil {
+		return r, err
+	}
+	r.Start, r.End = start, start
+	r.Name = icsUnescape(event["SUMMARY"])
+
+	if dtend, ok := event["DTEND"]; ok {
+		end, midnight, err := icsDate(dtend)
+		if err != nil {
+			return r, err
+		}
+		// 结束于0点时不包含当天
+		if midnight {
+			end = dateOf(time.Date(end.Year, end.Month, end.Day-1, 0, 0, 0, 0, time.UTC))
+		}
+		if end.key() > r.End.key() {
+			r.End = end
+		}
+	}
+	return r, nil
+}
+
+// icsDate 解析DATE(20060102)或DATE-TIME(20060102T150405[Z])值
+// 值为DATE或时间为0点时midnight为true
+func icsDate(value string) (d Date, midnight bool, err error) {
+	if len(value) < 8 {
+		return d, false, fmt.Errorf("invalid date %s", value)
+	}
+	t, err := time.Parse("20060102", value[:8])
+	if err != nil {
+		return d, false, fmt.Errorf("invalid date %s", value)
+	}
+	clock := strings.TrimSuffix(value[8:], "Z")
+	return dateOf(t), clock == "" || clock == "T000000", nil
+}
+
+func icsUnescape(s string) string {
+	return strings.NewReplacer(`\n`, " ", `\N`, " ", `\,`, ",", `\;`, ";", `\\`, `\`).Replace(s)
+}
@@ -5,14 +5,61 @@
 package crontab
 
 import (
+	"encoding/binary"
 	"errors"
 	"fmt"
-	"jiacrontab/pkg/util"
+	"hash/fnv"
+	"math/rand"
 	"time"
 )
 
 const (
 	starBit = 1 << 63
+	// DefaultHorizon 默认的最大调度周期(年)
+	DefaultHorizon = 5
+)
+
+// FinishedError 定时规则此后不会再触发
+type FinishedError struct {
+	Horizon int
+}
+
+func (e *FinishedError) Error() string {
+	return fmt.Sprintf("No execution time within %d years", e.Horizon)
+}
+
+// IsFinished 判断err是否表示定时规则不会再触发,包括超出有效期
+func IsFinished(err error) bool {
+	var e *FinishedError
+	return errors.As(err, &e) || IsExpired(err)
+}
+
+// ExpiredError 有效期内不会再触发
+type ExpiredError struct {
+	Until time.Time
+}
+
+func (e *ExpiredError) Error() string {
+	return fmt.Sprintf("No execution time before %s", e.Until.Format("2006-01-02 15:04:05"))
+}
+
+// IsExpired 判断err是否表示有效期内不会再触发
+func IsExpired(err error) bool {
+	var e *ExpiredError
+	return errors.As(err, &e)
+}
+
+// 夏令时切换策略
+// 仅对小时字段为具体值的job生效,小时字段为*的job按实际经过的时间调度
+const (
+	// DSTRepeatedOnce 时钟回拨导致重复出现的时刻只执行一次(默认)
+	DSTRepeatedOnce = "once"
+	// DSTRepeatedTwice 时钟回拨导致重复出现的时刻每次出现都执行
+	DSTRepeatedTwice = "twice"
+	// DSTSkippedFirstValid 时钟拨快导致不存在的时刻在切换后的第一个有效时刻执行(默认)
+	DSTSkippedFirstValid = "firstValid"
+	// DSTSkippedSkip 时钟拨快导致不存在的时刻不执行
+	DSTSkippedSkip = "skip"
 )
 
 type bounds struct {
@@ -26,6 +73,7 @@ var (
 	minutes = bounds{0, 59, nil}
 	hours   = bounds{0, 23, nil}
 	dom     = bounds{1, 31, nil}
+	years   = bounds{1970, 2099, nil}
 	months  = bounds{1, 12, map[string]uint{
 		"jan": 1,
 		"feb": 2,
@@ -58,13 +106,47 @@ type Job struct {
 	Day     string
 	Weekday string
 	Month   string
+	// Year 可选的年字段,为空时不限制年份
+	Year string
+	// Expr cron表达式,不为空时代替Second至Year字段
+	// 格式见parseExpr
+	Expr string
+	// Timezone IANA时区名称,例如Asia/Shanghai,为空时使用节点本地时区
+	Timezone string
+	// DSTRepeated 时钟回拨时重复时刻的处理策略,为空时同DSTRepeatedOnce
+	DSTRepeated string
+	// DSTSkipped 时钟拨快时不存在时刻的处理策略,为空时同DSTSkippedFirstValid
+	DSTSkipped string
+	// Horizon 查找下次执行时间的最大年数,为0时使用DefaultHorizon
+	Horizon int
+	// Jitter 每次执行前的随机延迟上限,精确到秒,为0时不延迟
+	Jitter time.Duration
+	// Spread 按ID哈希在该窗口内确定性地推迟执行,类似Jenkins的H,精确到秒
+	Spread time.Duration
+	// Calendars 排除日历,落在排除日期内的执行会被跳过
+	Calendars []*Calendar
+	// Interval 按固定间隔调度,不为0时代替cron规则
+	Interval time.Duration
+	// FixedDelay 为true时Interval从上次执行结束时开始计算,
+	// 调用方需在执行结束后再调用NextExecutionTime
+	FixedDelay bool
+	// ActiveFrom、ActiveUntil 有效期,为零值时不限制
+	ActiveFrom  time.Time
+	ActiveUntil time.Time
 
 	ID                uint
 	now               time.Time
 	lastExecutionTime time.Time
 	nextExecutionTime time.Time
+	scheduledTime     time.Time // 未加偏移的执行时间
+	excluded          []Skipped // 最近一次计算中被排除日历跳过的执行
 
 	second, minute, hour, dom, month, dow uint64
+	location                              *time.Location
+	every                                 time.Duration
+	domSpec                               *domSpec
+	dowSpecs                              []dowSpec
+	years                                 []uint
 
 	Value interface{}
 
@@ -72,8 +154,14 @@ type Job struct {
 }
 
 func (j *Job) Format() string {
-	return fmt.Sprintf("second: %s minute: %s hour: %s day: %s weekday: %s month: %s",
-		j.Second, j.Minute, j.Hour, j.Day, j.Weekday, j.Month)
+	if j.Interval > 0 {
+		return fmt.Sprintf("interval: %s fixedDelay: %t", j.Interval, j.FixedDelay)
+	}
+	if j.Expr != "" {
+		return fmt.Sprintf("expr: %s timezone: %s", j.Expr, j.Timezone)
+	}
+	return fmt.Sprintf("second: %s minute: %s hour: %s day: %s weekday: %s month: %s year: %s timezone: %s",
+		j.Second, j.Minute, j.Hour, j.Day, j.Weekday, j.Month, j.Year, j.Timezone)
 }
 func (j *Job) GetNextExecTime() time.Time {
 	return j.nextExecutionTime
@@ -83,50 +171,233 @@ func (j *Job) GetLastExecTime() time.Time {
 	return j.lastExecutionTime
 }
 
+// GetSkipped 获得最近一次计算下次执行时间时被排除日历跳过的执行
+func (j *Job) GetSkipped() []Skipped {
+	return j.excluded
+}
+
 // parse 解析定时规则
 // 根据规则生成符和条件的日期
 // 例如：*/2 如果位于分位，则生成0,2,4,6....58
 // 生成的日期逐条的被映射到uint64数值中
 // min |= 1<<2
+// 字段错误以*FieldError返回
 func (j *Job) parse() error {
-	var err error
-	field := func(field string, r bounds) uint64 {
+	if j.Interval > 0 {
+		j.every = j.Interval.Truncate(time.Second)
+		if j.every == 0 {
+			return fmt.Errorf("Interval should be at least 1s: %s", j.Interval)
+		}
+		var err error
+		j.location, err = LoadLocation(j.Timezone)
+		return err
+	}
+
+	e, err := j.expression()
+	if err != nil {
+		return err
+	}
+
+	field := func(name, field string, r bounds) uint64 {
 		if err != nil {
 			return 0
 		}
 		var bits uint64
 		bits, err = getField(field, r)
+		err = e.fieldError(name, field, err)
 		return bits
 	}
-	j.second = field(j.Second, seconds)
-	j.minute = field(j.Minute, minutes)
-	j.hour = field(j.Hour, hours)
-	j.dom = field(j.Day, dom)
-	j.month = field(j.Month, months)
-	j.dow = field(j.Weekday, dow)
 
-	return err
+	j.every = e.every
+	if j.every == 0 {
+		j.second = field(FieldSecond, e.second, seconds)
+		j.minute = field(FieldMinute, e.minute, minutes)
+		j.hour = field(FieldHour, e.hour, hours)
+		j.month = field(FieldMonth, e.month, months)
+		if err == nil {
+			j.dom, j.domSpec, err = parseDayOfMonth(e.day)
+			err = e.fieldError(FieldDay, e.day, err)
+		}
+		if err == nil {
+			j.dow, j.dowSpecs, err = parseDayOfWeek(e.weekday)
+			err = e.fieldError(FieldWeekday, e.weekday, err)
+		}
+		// 与Quartz一致,使用L、W或#时另一个字段必须为*或?,不按或的关系同时匹配
+		if err == nil && (j.domSpec != nil || len(j.dowSpecs) > 0) && j.dom&starBit == 0 && j.dow&starBit == 0 {
+			if len(j.dowSpecs) > 0 {
+				err = e.fieldError(FieldWeekday, e.weekday, fmt.Errorf("# and L require day of month to be * or ?: %s", e.day))
+			} else {
+				err = e.fieldError(FieldDay, e.day, fmt.Errorf("L and W require day of week to be * or ?: %s", e.weekday))
+			}
+		}
+		if err == nil {
+			j.years, err = parseYears(e.year)
+			err = e.fieldError(FieldYear, e.year, err)
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	switch j.DSTRepeated {
+	case "", DSTRepeatedOnce, DSTRepeatedTwice:
+	default:
+		return e.fieldError(FieldDSTRepeated, j.DSTRepeated, fmt.Errorf("Invalid DST repeated policy: %s", j.DSTRepeated))
+	}
+
+	switch j.DSTSkipped {
+	case "", DSTSkippedFirstValid, DSTSkippedSkip:
+	default:
+		return e.fieldError(FieldDSTSkipped, j.DSTSkipped, fmt.Errorf("Invalid DST skipped policy: %s", j.DSTSkipped))
+	}
+
+	j.location, err = LoadLocation(j.Timezone)
+	return e.fieldError(FieldTimezone, j.Timezone, err)
 
 }
 
+// expression 获得job的定时规则,Expr不为空时解析Expr
+func (j *Job) expression() (expression, error) {
+	if j.Expr != "" {
+		e, err := parseExpr(j.Expr)
+		if err != nil {
+			return e, &FieldError{Field: FieldExpr, Value: j.Expr, Index: -1, Offset: -1, Err: err}
+		}
+		return e, nil
+	}
+	return expression{
+		second:  j.Second,
+		minute:  j.Minute,
+		hour:    j.Hour,
+		day:     j.Day,
+		month:   j.Month,
+		weekday: j.Weekday,
+		year:    j.Year,
+	}, nil
+}
+
 // NextExecTime 获得下次执行时间
+// 夏令时切换时的处理策略见DSTRepeated、DSTSkipped
+// 返回的时间已加上Spread和Jitter产生的偏移,并跳过了Calendars中排除的日期
 func (j *Job) NextExecutionTime(t time.Time) (time.Time, error) {
+	j.excluded = nil
 	if err := j.parse(); err != nil {
 		return time.Time{}, err
 	}
 
+	// 在job所属时区中计算,保证月、日、时等字段按该时区的墙上时间匹配
+	t = t.In(j.location)
+	// 有效期开始前从ActiveFrom开始查找,ActiveFrom本身也可以执行
+	if t.Before(j.ActiveFrom) {
+		t = j.ActiveFrom.In(j.location).Add(-time.Nanosecond)
+	}
+	offset := j.SpreadOffset()
+
+	// 从可能落在t之后的最早原定时刻开始查找,但不早于上次的原定时刻,避免重复执行
+	from := t.Add(-offset - j.Jitter)
+	if from.Before(j.scheduledTime) && !t.Before(j.scheduledTime) {
+		from = j.scheduledTime
+	}
+
+	for {
+		scheduled, err := j.scheduleTime(from)
+		if err != nil {
+			return time.Time{}, err
+		}
+		next := scheduled.Add(offset + j.jitter())
+		if !next.After(t) {
+			from = scheduled
+			continue
+		}
+		if !j.ActiveUntil.IsZero() && next.After(j.ActiveUntil) {
+			return time.Time{}, &ExpiredError{Until: j.ActiveUntil}
+		}
+		// 直接跳到排除范围结束后继续查找
+		if s, ok := j.exclude(scheduled); ok {
+			j.excluded = append(j.excluded, s)
+			from = s.Until.Add(-time.Second)
+			continue
+		}
+		j.scheduledTime = scheduled
+		j.lastExecutionTime, j.nextExecutionTime = j.nextExecutionTime, next
+		return next, nil
+	}
+}
+
+// SpreadOffset 根据ID计算在Spread窗口内的固定偏移
+func (j *Job) SpreadOffset() time.Duration {
+	window := uint64(j.Spread / time.Second)
+	if window == 0 {
+		return 0
+	}
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], uint64(j.ID))
+	h := fnv.New64a()
+	h.Write(b[:])
+	return time.Duration(h.Sum64()%window) * time.Second
+}
+
+// jitter 随机生成本次执行的延迟
+func (j *Job) jitter() time.Duration {
+	n := int64(j.Jitter / time.Second)
+	if n <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(n+1)) * time.Second
+}
+
+// scheduleTime 获得t之后未加偏移的执行时间
+func (j *Job) scheduleTime(t time.Time) (time.Time, error) {
+	// @every按固定间隔调度,与墙上时间无关
+	if j.every > 0 {
+		base := t.Truncate(time.Second)
+		// 固定延迟保证距离执行结束至少Interval
+		if j.FixedDelay && base.Before(t) {
+			base = base.Add(time.Second)
+		}
+		return base.Add(j.every), nil
+	}
+
+	for {
+		next, err := j.next(t)
+		if err != nil {
+			return time.Time{}, err
+		}
+		t = next
+		// 时钟回拨时同一墙上时间会出现两次,默认只在第一次出现时执行
+		if j.DSTRepeated == DSTRepeatedTwice || j.hour&starBit > 0 || !isRepeatedWallClock(t) {
+			return t, nil
+		}
+	}
+}
+
+// next 按绝对时间逐步推进,查找t之后第一个匹配的时刻
+func (j *Job) next(t time.Time) (time.Time, error) {
 	t = t.Add(1*time.Second - time.Duration(t.Nanosecond())*time.Nanosecond)
 	added := false
-	defer func() {
-		j.lastExecutionTime, j.nextExecutionTime = j.nextExecutionTime, t
-	}()
 
-	// 设置最大调度周期为5年
-	yearLimit := t.Year() + 5
+	// 设置最大调度周期,默认为5年,指定年份时至少查找到最后一个年份
+	horizon := j.Horizon
+	if horizon <= 0 {
+		horizon = DefaultHorizon
+	}
+	yearLimit := t.Year() + horizon
+	if n := len(j.years); n > 0 && int(j.years[n-1]) > yearLimit {
+		yearLimit = int(j.years[n-1])
+	}
 
 WRAP:
 	if t.Year() > yearLimit {
-		return time.Time{}, errors.New("Over 5 years")
+		return time.Time{}, &FinishedError{Horizon: horizon}
+	}
+
+	if !j.yearMatches(t.Year()) {
+		year := j.nextYear(t.Year())
+		if year == 0 {
+			return time.Time{}, &FinishedError{Horizon: horizon}
+		}
+		added = true
+		t = time.Date(year, time.January, 1, 0, 0, 0, 0, t.Location())
 	}
 
 	for 1<<uint(t.Month())&j.month == 0 {
@@ -150,7 +421,11 @@ WRAP:
 			added = true
 			t = time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
 		}
+		prev := t
 		t = t.AddDate(0, 0, 1)
+		if j.skipped(prev, t) {
+			return t, nil
+		}
 
 		if t.Day() == 1 {
 			goto WRAP
@@ -162,7 +437,11 @@ WRAP:
 			added = true
 			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), 0, 0, 0, t.Location())
 		}
+		prev := t
 		t = t.Add(1 * time.Hour)
+		if j.skipped(prev, t) {
+			return t, nil
+		}
 
 		if t.Hour() == 0 {
 			goto WRAP
@@ -174,7 +453,11 @@ WRAP:
 			added = true
 			t = t.Truncate(time.Minute)
 		}
+		prev := t
 		t = t.Add(1 * time.Minute)
+		if j.skipped(prev, t) {
+			return t, nil
+		}
 
 		if t.Minute() == 0 {
 			goto WRAP
@@ -186,7 +469,11 @@ WRAP:
 			added = true
 			t = t.Truncate(time.Second)
 		}
+		prev := t
 		t = t.Add(1 * time.Second)
+		if j.skipped(prev, t) {
+			return t, nil
+		}
 
 		if t.Second() == 0 {
 			goto WRAP
@@ -196,20 +483,134 @@ WRAP:
 	return t, nil
 }
 
-func dayMatches(j *Job, t time.Time) bool {
+func (j *Job) yearMatches(year int) bool {
+	if j.years == nil {
+		return true
+	}
+	for _, y := range j.years {
+		if int(y) == year {
+			return true
+		}
+	}
+	return false
+}
 
-	if j.Day == "L" {
-		l := util.CountDaysOfMonth(t.Year(), int(t.Month()))
-		j.dom = getBits(uint(l), uint(l), 1)
+// nextYear 返回year之后第一个允许的年份,不存在时返回0
+func (j *Job) nextYear(year int) int {
+	for _, y := range j.years {
+		if int(y) > year {
+			return int(y)
+		}
+	}
+	return 0
+}
+
+// skipped 判断从prev推进到next时,是否因时钟拨快跳过了匹配的墙上时间
+// 默认策略下被跳过的执行时刻会在next,即切换后的第一个有效时刻执行
+func (j *Job) skipped(prev, next time.Time) bool {
+	if j.DSTSkipped == DSTSkippedSkip || j.hour&starBit > 0 {
+		return false
 	}
 
+	gap := wallClock(next).Sub(wallClock(prev)) - next.Sub(prev)
+	if gap <= 0 {
+		return false
+	}
+
+	// 逐分钟检查被跳过的墙上时间[next-gap, next)
+	end := wallClock(next)
+	for w := end.Add(-gap).Truncate(time.Minute); w.Before(end); w = w.Add(time.Minute) {
+		if j.yearMatches(w.Year()) && 1<<uint(w.Month())&j.month > 0 && dayMatches(j, w) &&
+			1<<uint(w.Hour())&j.hour > 0 && 1<<uint(w.Minute())&j.minute > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// isRepeatedWallClock 判断t的墙上时间是否在时钟回拨前已经出现过
+func isRepeatedWallClock(t time.Time) bool {
+	_, offset := t.Zone()
+	// 时钟回拨的幅度不超过2小时
+	_, before := t.Add(-2 * time.Hour).Zone()
+	if before <= offset {
+		return false
+	}
+	earlier := t.Add(-time.Duration(before-offset) * time.Second)
+	_, earlierOffset := earlier.Zone()
+	return earlierOffset == before && wallClock(earlier).Equal(wallClock(t))
+}
+
+// wallClock 将t的墙上时间转换为UTC时间,便于忽略时区偏移比较
+func wallClock(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), time.UTC)
+}
+
+// Location 返回job调度使用的时区
+func (j *Job) Location() *time.Location {
+	if j.location == nil {
+		if loc, err := LoadLocation(j.Timezone); err == nil {
+			return loc
+		}
+		return time.Local
+	}
+	return j.location
+}
+
+// LoadLocation 加载IANA时区,name为空时返回节点本地时区
+func LoadLocation(name string) (*time.Location, error) {
+	if name == "" {
+		return time.Local, nil
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid timezone %s: %s", name, err)
+	}
+	return loc, nil
+}
+
+// Validate 校验定时规则
+func (j *Job) Validate() error {
+	return j.parse()
+}
+
+func dayMatches(j *Job, t time.Time) bool {
 	var (
-		domMatch bool = 1<<uint(t.Day())&j.dom > 0
+		domMatch bool = 1<<uint(t.Day())&j.dom > 0 || j.domSpec.matches(t)
 		dowMatch bool = 1<<uint(t.Weekday())&j.dow > 0
 	)
 
+	for _, spec := range j.dowSpecs {
+		if dowMatch {
+			break
+		}
+		dowMatch = spec.matches(t)
+	}
+
 	if j.dom&starBit > 0 || j.dow&starBit > 0 {
 		return domMatch && dowMatch
 	}
 	return domMatch || dowMatch
 }
+
+// NextExecutionTimes 从t开始连续计算最多n次执行时间,同时返回期间被排除日历跳过的执行
+// 定时规则不再触发时返回已得到的时间
+func (j *Job) NextExecutionTimes(t time.Time, n int) ([]time.Time, []Skipped, error) {
+	var (
+		list    []time.Time
+		skipped []Skipped
+	)
+	for i := 0; i < n; i++ {
+		next, err := j.NextExecutionTime(t)
+		skipped = append(skipped, j.excluded...)
+		if IsFinished(err) {
+			break
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		list = append(list, next)
+		t = next
+	}
+	return list, skipped, nil
+}
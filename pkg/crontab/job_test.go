@@ -8,6 +8,7 @@ import (
 
 func TestJob_NextExecutionTime(t *testing.T) {
 	timeLayout := "2006-01-02 15:04:05"
+	start := time.Date(2019, 12, 1, 0, 0, 0, 0, time.Local)
 	j := &Job{
 		Second:  "48",
 		Minute:  "3",
@@ -17,7 +18,7 @@ func TestJob_NextExecutionTime(t *testing.T) {
 		Month:   "1",
 	}
 
-	tt, err := j.NextExecutionTime(time.Now())
+	tt, err := j.NextExecutionTime(start)
 	test.Nil(t, err)
 	test.Equal(t, "2020-01-25 12:03:48", tt.Format(timeLayout))
 
@@ -36,7 +37,7 @@ func TestJob_NextExecutionTime(t *testing.T) {
 		Weekday: "*",
 		Month:   "3",
 	}
-	tt, err = j.NextExecutionTime(time.Now())
+	tt, err = j.NextExecutionTime(start)
 	test.Nil(t, err)
 	test.Equal(t, "2020-03-04 12:00:58", tt.Format(timeLayout))
 
@@ -68,3 +69,367 @@ func TestJob_NextExecutionTime(t *testing.T) {
 
 	t.Log("end")
 }
+
+func TestJob_NextExecutionTimeWithTimezone(t *testing.T) {
+	timeLayout := "2006-01-02 15:04:05 MST"
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	j := &Job{
+		Second:   "0",
+		Minute:   "0",
+		Hour:     "9",
+		Day:      "*",
+		Weekday:  "*",
+		Month:    "*",
+		Timezone: "Asia/Shanghai",
+	}
+
+	tt, err := j.NextExecutionTime(start)
+	test.Nil(t, err)
+	test.Equal(t, "2020-01-01 09:00:00 CST", tt.Format(timeLayout))
+	test.Equal(t, "2020-01-01 01:00:00 UTC", tt.UTC().Format(timeLayout))
+
+	j.Timezone = "America/New_York"
+	tt, err = j.NextExecutionTime(start)
+	test.Nil(t, err)
+	test.Equal(t, "2020-01-01 09:00:00 EST", tt.Format(timeLayout))
+	test.Equal(t, "2020-01-01 14:00:00 UTC", tt.UTC().Format(timeLayout))
+
+	j.Timezone = "Invalid/Zone"
+	_, err = j.NextExecutionTime(start)
+	test.NotNil(t, err)
+}
+
+func TestJob_NextExecutionTimeDST(t *testing.T) {
+	timeLayout := "2006-01-02 15:04:05 MST"
+	loc, err := time.LoadLocation("America/New_York")
+	test.Nil(t, err)
+
+	tests := []struct {
+		name     string
+		job      Job
+		start    time.Time
+		expected []string
+	}{
+		{
+			name:  "spring forward runs skipped time at first valid instant",
+			job:   Job{Second: "0", Minute: "30", Hour: "2", Day: "*", Weekday: "*", Month: "*"},
+			start: time.Date(2020, 3, 7, 12, 0, 0, 0, loc),
+			expected: []string{
+				"2020-03-08 03:00:00 EDT",
+				"2020-03-09 02:30:00 EDT",
+			},
+		},
+		{
+			name:  "spring forward skip policy",
+			job:   Job{Second: "0", Minute: "30", Hour: "2", Day: "*", Weekday: "*", Month: "*", DSTSkipped: DSTSkippedSkip},
+			start: time.Date(2020, 3, 7, 12, 0, 0, 0, loc),
+			expected: []string{
+				"2020-03-09 02:30:00 EDT",
+			},
+		},
+		{
+			name:  "spring forward runs once for many skipped times",
+			job:   Job{Second: "0", Minute: "*/15", Hour: "2", Day: "*", Weekday: "*", Month: "*"},
+			start: time.Date(2020, 3, 8, 1, 50, 0, 0, loc),
+			expected: []string{
+				"2020-03-08 03:00:00 EDT",
+				"2020-03-09 02:00:00 EDT",
+			},
+		},
+		{
+			name:  "spring forward does not affect hourly jobs",
+			job:   Job{Second: "0", Minute: "30", Hour: "*", Day: "*", Weekday: "*", Month: "*"},
+			start: time.Date(2020, 3, 8, 1, 0, 0, 0, loc),
+			expected: []string{
+				"2020-03-08 01:30:00 EST",
+				"2020-03-08 03:30:00 EDT",
+			},
+		},
+		{
+			name:  "fall back runs repeated time once",
+			job:   Job{Second: "0", Minute: "30", Hour: "1", Day: "*", Weekday: "*", Month: "*"},
+			start: time.Date(2020, 11, 1, 0, 0, 0, 0, loc),
+			expected: []string{
+				"2020-11-01 01:30:00 EDT",
+				"2020-11-02 01:30:00 EST",
+			},
+		},
+		{
+			name:  "fall back twice policy",
+			job:   Job{Second: "0", Minute: "30", Hour: "1", Day: "*", Weekday: "*", Month: "*", DSTRepeated: DSTRepeatedTwice},
+			start: time.Date(2020, 11, 1, 0, 0, 0, 0, loc),
+			expected: []string{
+				"2020-11-01 01:30:00 EDT",
+				"2020-11-01 01:30:00 EST",
+				"2020-11-02 01:30:00 EST",
+			},
+		},
+		{
+			name:  "fall back runs hourly jobs by elapsed time",
+			job:   Job{Second: "0", Minute: "0", Hour: "*", Day: "*", Weekday: "*", Month: "*"},
+			start: time.Date(2020, 11, 1, 0, 30, 0, 0, loc),
+			expected: []string{
+				"2020-11-01 01:00:00 EDT",
+				"2020-11-01 01:00:00 EST",
+				"2020-11-01 02:00:00 EST",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			j := tt.job
+			j.Timezone = "America/New_York"
+			next := tt.start
+			for _, expected := range tt.expected {
+				next, err = j.NextExecutionTime(next)
+				test.Nil(t, err)
+				test.Equal(t, expected, next.Format(timeLayout))
+			}
+		})
+	}
+}
+
+func TestJob_NextExecutionTimeExpr(t *testing.T) {
+	timeLayout := "2006-01-02 15:04:05"
+	start := time.Date(2020, 1, 15, 10, 20, 30, 0, time.Local)
+
+	tests := []struct {
+		expr     string
+		expected string
+	}{
+		{"30 2 * * *", "2020-01-16 02:30:00"},
+		{"15 30 2 * * *", "2020-01-16 02:30:15"},
+		{"0 9 * * mon-fri", "2020-01-16 09:00:00"},
+		{"*/5 * * * * ?", "2020-01-15 10:20:35"},
+		{"@yearly", "2021-01-01 00:00:00"},
+		{"@annually", "2021-01-01 00:00:00"},
+		{"@monthly", "2020-02-01 00:00:00"},
+		{"@weekly", "2020-01-19 00:00:00"},
+		{"@daily", "2020-01-16 00:00:00"},
+		{"@hourly", "2020-01-15 11:00:00"},
+		{"@every 90m", "2020-01-15 11:50:30"},
+		{"@every 1h30m10s", "2020-01-15 11:50:40"},
+	}
+
+	for _, tt := range tests {
+		j := &Job{Expr: tt.expr}
+		next, err := j.NextExecutionTime(start)
+		test.Nil(t, err)
+		test.Equal(t, tt.expected, next.Format(timeLayout))
+	}
+
+	for _, expr := range []string{"* * * *", "* * * * * * * *", "@never", "@every 10ms", "@every x", "61 * * * *"} {
+		j := &Job{Expr: expr}
+		test.NotNil(t, j.Validate())
+	}
+}
+
+func TestJob_NextExecutionTimeSpecialDays(t *testing.T) {
+	timeLayout := "2006-01-02"
+
+	tests := []struct {
+		day      string
+		weekday  string
+		start    time.Time
+		expected string
+	}{
+		{"L", "*", time.Date(2020, 2, 1, 0, 0, 0, 0, time.Local), "2020-02-29"},
+		{"L-2", "*", time.Date(2020, 2, 1, 0, 0, 0, 0, time.Local), "2020-02-27"},
+		{"LW", "*", time.Date(2020, 5, 1, 0, 0, 0, 0, time.Local), "2020-05-29"},
+		{"lw", "?", time.Date(2020, 7, 1, 0, 0, 0, 0, time.Local), "2020-07-31"},
+		{"15W", "*", time.Date(2020, 8, 1, 0, 0, 0, 0, time.Local), "2020-08-14"},
+		{"1W", "*", time.Date(2020, 1, 31, 12, 0, 0, 0, time.Local), "2020-02-03"},
+		{"31W", "*", time.Date(2020, 2, 1, 0, 0, 0, 0, time.Local), "2020-03-31"},
+		{"?", "MON#2", time.Date(2020, 6, 1, 0, 0, 0, 0, time.Local), "2020-06-08"},
+		{"?", "1#1,3#3", time.Date(2020, 6, 2, 0, 0, 0, 0, time.Local), "2020-06-17"},
+		{"?", "FRIL", time.Date(2020, 7, 1, 0, 0, 0, 0, time.Local), "2020-07-31"},
+		{"?", "5L", time.Date(2020, 8, 1, 0, 0, 0, 0, time.Local), "2020-08-28"},
+		// 单独的L表示周六
+		{"?", "L", time.Date(2020, 6, 1, 0, 0, 0, 0, time.Local), "2020-06-06"},
+		{"?", "1,L", time.Date(2020, 6, 1, 12, 0, 0, 0, time.Local), "2020-06-06"},
+		{"*", "l", time.Date(2020, 6, 7, 0, 0, 0, 0, time.Local), "2020-06-13"},
+	}
+
+	for _, tt := range tests {
+		j := &Job{Second: "0", Minute: "0", Hour: "0", Day: tt.day, Weekday: tt.weekday, Month: "*"}
+		next, err := j.NextExecutionTime(tt.start)
+		test.Nil(t, err)
+		test.Equal(t, tt.expected, next.Format(timeLayout))
+	}
+
+	invalid := []struct {
+		day     string
+		weekday string
+	}{
+		{"1,15W", "*"},
+		{"1-15W", "*"},
+		{"L,5", "*"},
+		{"*/LW", "*"},
+		{"32W", "*"},
+		{"L-31", "*"},
+		{"*", "MON#6"},
+		{"*", "MON#0"},
+		{"*", "1-3#2"},
+		{"*", "7L"},
+		{"?", "#2"},
+		// L、W和#不能与另一个字段的具体值同时使用
+		{"L", "MON"},
+		{"15W", "1-5"},
+		{"15", "MON#2"},
+		{"1,15", "FRIL"},
+		{"LW", "L"},
+	}
+
+	for _, tt := range invalid {
+		j := &Job{Second: "0", Minute: "0", Hour: "0", Day: tt.day, Weekday: tt.weekday, Month: "*"}
+		test.NotNil(t, j.Validate())
+	}
+
+	j := &Job{Second: "0", Minute: "0", Hour: "L", Day: "*", Weekday: "*", Month: "*"}
+	test.NotNil(t, j.Validate())
+}
+
+func TestJob_NextExecutionTimeYear(t *testing.T) {
+	timeLayout := "2006-01-02 15:04:05"
+	start := time.Date(2026, 10, 18, 0, 0, 0, 0, time.Local)
+
+	j := &Job{Second: "0", Minute: "0", Hour: "0", Day: "1", Weekday: "*", Month: "1", Year: "2027"}
+	next, err := j.NextExecutionTime(start)
+	test.Nil(t, err)
+	test.Equal(t, "2027-01-01 00:00:00", next.Format(timeLayout))
+
+	_, err = j.NextExecutionTime(next)
+	test.Equal(t, true, IsFinished(err))
+
+	// 指定的年份超出默认的查找范围
+	j = &Job{Expr: "0 0 0 1 1 * 2040"}
+	next, err = j.NextExecutionTime(start)
+	test.Nil(t, err)
+	test.Equal(t, "2040-01-01 00:00:00", next.Format(timeLayout))
+
+	j = &Job{Second: "0", Minute: "0", Hour: "0", Day: "29", Weekday: "*", Month: "2"}
+	next, err = j.NextExecutionTime(start)
+	test.Nil(t, err)
+	test.Equal(t, "2028-02-29 00:00:00", next.Format(timeLayout))
+	next, err = j.NextExecutionTime(next)
+	test.Nil(t, err)
+	test.Equal(t, "2032-02-29 00:00:00", next.Format(timeLayout))
+
+	j = &Job{Expr: "0 0 0 29 2 * 2027-2030/2"}
+	_, err = j.NextExecutionTime(start)
+	test.Equal(t, true, IsFinished(err))
+
+	j = &Job{Second: "0", Minute: "0", Hour: "0", Day: "30", Weekday: "*", Month: "2", Horizon: 1}
+	_, err = j.NextExecutionTime(start)
+	test.Equal(t, true, IsFinished(err))
+
+	j = &Job{Second: "0", Minute: "0", Hour: "0", Day: "*", Weekday: "*", Month: "*", Year: "1969"}
+	test.NotNil(t, j.Validate())
+}
+
+func TestJob_NextExecutionTimeSpread(t *testing.T) {
+	start := time.Date(2026, 10, 18, 12, 0, 0, 0, time.Local)
+	midnight := time.Date(2026, 10, 19, 0, 0, 0, 0, time.Local)
+
+	// 相同ID的偏移固定,不同ID分散在窗口内
+	offsets := make(map[time.Duration]bool)
+	for id := uint(1); id <= 100; id++ {
+		j := &Job{Expr: "0 0 0 * * *", ID: id, Spread: time.Hour}
+		next, err := j.NextExecutionTime(start)
+		test.Nil(t, err)
+		offset := next.Sub(midnight)
+		test.Equal(t, j.SpreadOffset(), offset)
+		test.Equal(t, true, offset >= 0 && offset < time.Hour)
+		test.Equal(t, time.Duration(0), offset%time.Second)
+		offsets[offset] = true
+
+		// 在偏移后的时刻继续计算不会跳过或重复
+		next, err = j.NextExecutionTime(next)
+		test.Nil(t, err)
+		test.Equal(t, midnight.AddDate(0, 0, 1).Add(offset), next)
+	}
+	test.Equal(t, true, len(offsets) > 50)
+
+	// 偏移窗口内重启时不会错过当天的执行
+	j := &Job{Expr: "0 0 0 * * *", ID: 1, Spread: time.Hour}
+	offset := j.SpreadOffset()
+	next, err := j.NextExecutionTime(midnight.Add(offset - time.Second))
+	test.Nil(t, err)
+	test.Equal(t, midnight.Add(offset), next)
+}
+
+func TestJob_NextExecutionTimeJitter(t *testing.T) {
+	start := time.Date(2026, 10, 18, 0, 2, 30, 0, time.Local)
+
+	j := &Job{Expr: "0 */5 * * * *", Jitter: time.Minute}
+	next := start
+	for i := 0; i < 100; i++ {
+		prev := next
+		var err error
+		next, err = j.NextExecutionTime(prev)
+		test.Nil(t, err)
+		scheduled := start.Truncate(5 * time.Minute).Add(time.Duration(i+1) * 5 * time.Minute)
+		test.Equal(t, true, next.After(prev))
+		test.Equal(t, true, !next.Before(scheduled) && !next.After(scheduled.Add(time.Minute)))
+		test.Equal(t, time.Duration(0), next.Sub(scheduled)%time.Second)
+	}
+}
+
+func TestJob_NextExecutionTimeActiveWindow(t *testing.T) {
+	timeLayout := "2006-01-02 15:04:05"
+	from := time.Date(2026, 11, 1, 9, 0, 0, 0, time.Local)
+	until := time.Date(2026, 11, 3, 9, 0, 0, 0, time.Local)
+
+	j := &Job{Expr: "0 0 9 * * *", ActiveFrom: from, ActiveUntil: until}
+	list, _, err := j.NextExecutionTimes(time.Date(2026, 10, 18, 0, 0, 0, 0, time.Local), 10)
+	test.Nil(t, err)
+	test.Equal(t, 3, len(list))
+	test.Equal(t, "2026-11-01 09:00:00", list[0].Format(timeLayout))
+	test.Equal(t, "2026-11-03 09:00:00", list[2].Format(timeLayout))
+
+	_, err = j.NextExecutionTime(list[2])
+	test.Equal(t, true, IsExpired(err))
+	test.Equal(t, true, IsFinished(err))
+
+	// 按字段设置的规则同样受有效期限制,恰好在截止时刻的执行有效
+	j = &Job{Second: "0", Minute: "0", Hour: "9", Day: "*", Weekday: "*", Month: "*", Year: "2026",
+		ActiveFrom: from, ActiveUntil: until}
+	next, err := j.NextExecutionTime(until.Add(-time.Second))
+	test.Nil(t, err)
+	test.Equal(t, until, next)
+	_, err = j.NextExecutionTime(until)
+	test.Equal(t, true, IsExpired(err))
+
+	// 规则本身在截止时间前结束时不是超出有效期
+	j.ActiveUntil = time.Date(2027, 6, 1, 0, 0, 0, 0, time.Local)
+	_, err = j.NextExecutionTime(time.Date(2026, 12, 31, 9, 0, 0, 0, time.Local))
+	test.Equal(t, false, IsExpired(err))
+	test.Equal(t, true, IsFinished(err))
+}
+
+func TestJob_NextExecutionTimeInterval(t *testing.T) {
+	start := time.Date(2026, 10, 18, 8, 0, 0, 0, time.Local)
+
+	// 固定间隔调度忽略cron字段
+	j := &Job{Interval: 90 * time.Second, Second: "61"}
+	next, err := j.NextExecutionTime(start)
+	test.Nil(t, err)
+	test.Equal(t, start.Add(90*time.Second), next)
+	next, err = j.NextExecutionTime(start.Add(500 * time.Millisecond))
+	test.Nil(t, err)
+	test.Equal(t, start.Add(90*time.Second), next)
+
+	// 固定延迟从执行结束时刻起至少间隔Interval
+	j = &Job{Interval: time.Minute, FixedDelay: true}
+	next, err = j.NextExecutionTime(start.Add(500 * time.Millisecond))
+	test.Nil(t, err)
+	test.Equal(t, start.Add(61*time.Second), next)
+	next, err = j.NextExecutionTime(start.Add(10 * time.Minute))
+	test.Nil(t, err)
+	test.Equal(t, start.Add(11*time.Minute), next)
+
+	_, err = (&Job{Interval: time.Millisecond}).NextExecutionTime(start)
+	test.NotNil(t, err)
+}
@@ -2,32 +2,366 @@ package crontab
 
 import (
 	"fmt"
+	"jiacrontab/pkg/util"
 	"math"
+	"sort"
 	"strconv"
 	"strings"
+	"time"
 )
 
-func getRange(expr string, r bounds) (uint64, error) {
+// macros 预定义的调度宏,展开为6位表达式
+var macros = map[string]string{
+	"@yearly":   "0 0 0 1 1 *",
+	"@annually": "0 0 0 1 1 *",
+	"@monthly":  "0 0 0 1 * *",
+	"@weekly":   "0 0 0 * * 0",
+	"@daily":    "0 0 0 * * *",
+	"@midnight": "0 0 0 * * *",
+	"@hourly":   "0 0 * * * *",
+}
+
+const everyPrefix = "@every "
+
+// 定时规则各字段的名称,与FieldError.Field对应
+const (
+	FieldExpr        = "expr"
+	FieldSecond      = "second"
+	FieldMinute      = "minute"
+	FieldHour        = "hour"
+	FieldDay         = "day"
+	FieldMonth       = "month"
+	FieldWeekday     = "weekday"
+	FieldYear        = "year"
+	FieldTimezone    = "timezone"
+	FieldDSTRepeated = "dstRepeated"
+	FieldDSTSkipped  = "dstSkipped"
+)
+
+// FieldError 定时规则中某个字段的错误
+type FieldError struct {
+	Field string
+	Value string
+	// Index 字段在cron表达式中的序号,从0开始,未使用cron表达式时为-1
+	Index int
+	// Offset 字段在cron表达式中的字符偏移量,未使用cron表达式时为-1
+	Offset int
+	Err    error
+}
+
+func (e *FieldError) Error() string {
+	if e.Index >= 0 {
+		return fmt.Sprintf("Invalid %s field %q at position %d (offset %d): %v", e.Field, e.Value, e.Index, e.Offset, e.Err)
+	}
+	return fmt.Sprintf("Invalid %s field %q: %v", e.Field, e.Value, e.Err)
+}
+
+func (e *FieldError) Unwrap() error {
+	return e.Err
+}
+
+type fieldPos struct {
+	index, offset int
+}
+
+// expression 解析后的cron表达式
+type expression struct {
+	second, minute, hour, day, month, weekday, year string
+	every                                           time.Duration
+	// pos 各字段在cron表达式中的位置
+	pos map[string]fieldPos
+}
+
+// fieldError 生成带有字段位置的错误
+func (e expression) fieldError(field, value string, err error) error {
+	if err == nil {
+		return nil
+	}
+	pos, ok := e.pos[field]
+	if !ok {
+		pos = fieldPos{-1, -1}
+	}
+	return &FieldError{Field: field, Value: value, Index: pos.index, Offset: pos.offset, Err: err}
+}
+
+// splitFields 按空白分割表达式,同时返回每个字段的字符偏移量
+func splitFields(expr string) (fields []string, offsets []int) {
+	start := -1
+	for i, r := range expr + " " {
+		if r == ' ' || r == '\t' {
+			if start >= 0 {
+				fields = append(fields, expr[start:i])
+				offsets = append(offsets, start)
+				start = -1
+			}
+			continue
+		}
+		if start < 0 {
+			start = i
+		}
+	}
+	return
+}
+
+// parseExpr 解析cron表达式
+// 支持5位(分 时 日 月 周)、6位(秒 分 时 日 月 周)、7位(秒 分 时 日 月 周 年)表达式,
+// 以及@yearly、@monthly、@weekly、@daily、@hourly和@every <duration>
+func parseExpr(expr string) (expression, error) {
+	var e expression
+	raw := expr
+	expr = strings.TrimSpace(expr)
+
+	if strings.HasPrefix(expr, everyPrefix) {
+		d, err := time.ParseDuration(strings.TrimSpace(expr[len(everyPrefix):]))
+		if err != nil {
+			return e, fmt.Errorf("Failed to parse duration %s: %s", expr, err)
+		}
+		if d < time.Second {
+			return e, fmt.Errorf("Duration of @every should be at least 1s: %s", expr)
+		}
+		e.every = d.Truncate(time.Second)
+		return e, nil
+	}
+
+	if strings.HasPrefix(expr, "@") {
+		m, ok := macros[strings.ToLower(expr)]
+		if !ok {
+			return e, fmt.Errorf("Unrecognized macro: %s", expr)
+		}
+		expr = m
+		raw = ""
+	}
+
+	fields := strings.Fields(expr)
+	names := []string{FieldSecond, FieldMinute, FieldHour, FieldDay, FieldMonth, FieldWeekday, FieldYear}
+	switch len(fields) {
+	case 5:
+		fields = append([]string{"0"}, fields...)
+		names = names[1:6]
+	case 6:
+		names = names[:6]
+	case 7:
+		e.year = fields[6]
+	default:
+		return e, fmt.Errorf("Expected 5 to 7 fields, found %d: %s", len(fields), expr)
+	}
+
+	// 宏展开后的字段不属于用户输入,不记录位置
+	if raw != "" {
+		_, offsets := splitFields(raw)
+		e.pos = make(map[string]fieldPos, len(names))
+		for i, name := range names {
+			e.pos[name] = fieldPos{index: i, offset: offsets[i]}
+		}
+	}
+
+	e.second, e.minute, e.hour = fields[0], fields[1], fields[2]
+	e.day, e.month, e.weekday = fields[3], fields[4], fields[5]
+	return e, nil
+}
+
+const (
+	// domLast L或L-n: 当月最后一天或倒数第n+1天
+	domLast = iota
+	// domLastWeekday LW: 当月最后一个工作日
+	domLastWeekday
+	// domNearestWeekday nW: 距离当月第n天最近的工作日,不跨月
+	domNearestWeekday
+)
+
+// domSpec 日字段中的L、LW、nW规则
+type domSpec struct {
+	kind int
+	day  uint
+}
+
+func (s *domSpec) matches(t time.Time) bool {
+	if s == nil {
+		return false
+	}
+
+	last := uint(util.CountDaysOfMonth(t.Year(), int(t.Month())))
+	day := uint(t.Day())
+
+	switch s.kind {
+	case domLast:
+		return s.day < last && day == last-s.day
+	case domLastWeekday:
+		switch time.Date(t.Year(), t.Month(), int(last), 0, 0, 0, 0, time.UTC).Weekday() {
+		case time.Saturday:
+			return day == last-1
+		case time.Sunday:
+			return day == last-2
+		}
+		return day == last
+	case domNearestWeekday:
+		if s.day > last {
+			return false
+		}
+		target := s.day
+		switch time.Date(t.Year(), t.Month(), int(s.day), 0, 0, 0, 0, time.UTC).Weekday() {
+		case time.Saturday:
+			if target == 1 {
+				target = 3
+			} else {
+				target--
+			}
+		case time.Sunday:
+			if target == last {
+				target -= 2
+			} else {
+				target++
+			}
+		}
+		return day == target
+	}
+	return false
+}
+
+// dowSpec 周字段中的n#m(当月第m个周n)、nL(当月最后一个周n)规则
+type dowSpec struct {
+	weekday uint
+	// nth 为0时表示最后一个
+	nth uint
+}
+
+func (s dowSpec) matches(t time.Time) bool {
+	if uint(t.Weekday()) != s.weekday {
+		return false
+	}
+	if s.nth == 0 {
+		return t.Day()+7 > util.CountDaysOfMonth(t.Year(), int(t.Month()))
+	}
+	return uint(t.Day()-1)/7+1 == s.nth
+}
+
+// parseDayOfMonth 解析日字段
+// 除常规语法外支持L、L-n、LW和nW,这些规则不能与其它值组合使用,周字段需为*或?
+func parseDayOfMonth(field string) (uint64, *domSpec, error) {
+	upper := strings.ToUpper(field)
+	if !strings.ContainsAny(upper, "LW") {
+		bits, err := getField(field, dom)
+		return bits, nil, err
+	}
+
+	if strings.ContainsAny(upper, ",/*?") || (strings.Contains(upper, "-") && !strings.HasPrefix(upper, "L-")) {
+		return 0, nil, fmt.Errorf("L and W cannot be combined with lists, ranges or steps: %s", field)
+	}
+
+	switch {
+	case upper == "L":
+		return 0, &domSpec{kind: domLast}, nil
+	case upper == "LW":
+		return 0, &domSpec{kind: domLastWeekday}, nil
+	case strings.HasPrefix(upper, "L-"):
+		offset, err := mustParseInt(upper[2:])
+		if err != nil {
+			return 0, nil, err
+		}
+		if offset >= dom.max {
+			return 0, nil, fmt.Errorf("Offset of L (%d) should be less than %d: %s", offset, dom.max, field)
+		}
+		return 0, &domSpec{kind: domLast, day: offset}, nil
+	case strings.HasSuffix(upper, "W"):
+		day, err := mustParseInt(upper[:len(upper)-1])
+		if err != nil {
+			return 0, nil, err
+		}
+		if day < dom.min || day > dom.max {
+			return 0, nil, fmt.Errorf("Day of W (%d) out of range [%d,%d]: %s", day, dom.min, dom.max, field)
+		}
+		return 0, &domSpec{kind: domNearestWeekday, day: day}, nil
+	}
+	return 0, nil, fmt.Errorf("Unsupported day of month: %s", field)
+}
+
+// parseDayOfWeek 解析周字段
+// 除常规语法外支持n#m和nL,例如MON#2表示当月第二个周一,FRIL表示当月最后一个周五,日字段需为*或?
+// 单独的L与Quartz一致表示一周的最后一天,即周六
+func parseDayOfWeek(field string) (uint64, []dowSpec, error) {
 	var (
-		start, end, step uint
-		rangeAndStep     = strings.Split(expr, "/")
-		lowAndHigh       = strings.Split(rangeAndStep[0], "-")
-		singleDigit      = len(lowAndHigh) == 1
-		err              error
+		bits  uint64
+		specs []dowSpec
 	)
 
+	ranges := strings.FieldsFunc(field, func(r rune) bool { return r == ',' })
+	for _, expr := range ranges {
+		upper := strings.ToUpper(expr)
+		if upper == "L" {
+			bits |= 1 << uint(time.Saturday)
+			continue
+		}
+		if !strings.Contains(upper, "#") && !strings.HasSuffix(upper, "L") {
+			bit, err := getRange(expr, dow)
+			if err != nil {
+				return bits, specs, err
+			}
+			bits |= bit
+			continue
+		}
+
+		if strings.ContainsAny(upper, "/*?-") {
+			return bits, specs, fmt.Errorf("# and L cannot be combined with ranges or steps: %s", expr)
+		}
+
+		var (
+			name = upper
+			nth  uint
+			err  error
+		)
+		if i := strings.Index(upper, "#"); i >= 0 {
+			name = upper[:i]
+			if nth, err = mustParseInt(upper[i+1:]); err != nil {
+				return bits, specs, err
+			}
+			if nth < 1 || nth > 5 {
+				return bits, specs, fmt.Errorf("Nth weekday (%d) should be between 1 and 5: %s", nth, expr)
+			}
+		} else {
+			name = strings.TrimSuffix(upper, "L")
+		}
+
+		weekday, err := parseIntOrName(name, dow.names)
+		if err != nil {
+			return bits, specs, err
+		}
+		if weekday > dow.max {
+			return bits, specs, fmt.Errorf("Weekday (%d) above maximum (%d): %s", weekday, dow.max, expr)
+		}
+		specs = append(specs, dowSpec{weekday: weekday, nth: nth})
+	}
+	return bits, specs, nil
+}
+
+func getRange(expr string, r bounds) (uint64, error) {
+	start, end, step, star, err := parseRange(expr, r)
+	if err != nil {
+		return 0, err
+	}
+
 	var extra uint64
+	if star {
+		extra = starBit
+	}
+	return getBits(start, end, step) | extra, nil
+}
+
+// parseRange 解析单个范围表达式,例如*、5、1-10、*/2、1-10/3
+func parseRange(expr string, r bounds) (start, end, step uint, star bool, err error) {
+	var (
+		rangeAndStep = strings.Split(expr, "/")
+		lowAndHigh   = strings.Split(rangeAndStep[0], "-")
+		singleDigit  = len(lowAndHigh) == 1
+	)
+
 	if lowAndHigh[0] == "*" || lowAndHigh[0] == "?" {
 		start = r.min
 		end = r.max
-		extra = starBit
+		star = true
 	} else {
-		if lowAndHigh[0] == "L" {
-			return 0, nil
-		}
 		start, err = parseIntOrName(lowAndHigh[0], r.names)
 		if err != nil {
-			return 0, err
+			return
 		}
 
 		switch len(lowAndHigh) {
@@ -36,10 +370,11 @@ func getRange(expr string, r bounds) (uint64, error) {
 		case 2:
 			end, err = parseIntOrName(lowAndHigh[1], r.names)
 			if err != nil {
-				return 0, err
+				return
 			}
 		default:
-			return 0, fmt.Errorf("Too many hyphens: %s", expr)
+			err = fmt.Errorf("Too many hyphens: %s", expr)
+			return
 		}
 	}
 
@@ -49,7 +384,7 @@ func getRange(expr string, r bounds) (uint64, error) {
 	case 2:
 		step, err = mustParseInt(rangeAndStep[1])
 		if err != nil {
-			return 0, err
+			return
 		}
 
 		// Special handling: "N/step" means "N-max/step".
@@ -57,23 +392,49 @@ func getRange(expr string, r bounds) (uint64, error) {
 			end = r.max
 		}
 	default:
-		return 0, fmt.Errorf("Too many slashes: %s", expr)
+		err = fmt.Errorf("Too many slashes: %s", expr)
+		return
 	}
 
 	if start < r.min {
-		return 0, fmt.Errorf("Beginning of range (%d) below minimum (%d): %s", start, r.min, expr)
-	}
-	if end > r.max {
-		return 0, fmt.Errorf("End of range (%d) above maximum (%d): %s", end, r.max, expr)
+		err = fmt.Errorf("Beginning of range (%d) below minimum (%d): %s", start, r.min, expr)
+	} else if end > r.max {
+		err = fmt.Errorf("End of range (%d) above maximum (%d): %s", end, r.max, expr)
+	} else if start > end {
+		err = fmt.Errorf("Beginning of range (%d) beyond end of range (%d): %s", start, end, expr)
+	} else if step == 0 {
+		err = fmt.Errorf("Step of range should be a positive number: %s", expr)
 	}
-	if start > end {
-		return 0, fmt.Errorf("Beginning of range (%d) beyond end of range (%d): %s", start, end, expr)
+	return
+}
+
+// parseYears 解析年字段,返回升序排列的年份,为空或*时返回nil表示不限制
+func parseYears(field string) ([]uint, error) {
+	if field == "" {
+		return nil, nil
 	}
-	if step == 0 {
-		return 0, fmt.Errorf("Step of range should be a positive number: %s", expr)
+
+	set := make(map[uint]bool)
+	ranges := strings.FieldsFunc(field, func(r rune) bool { return r == ',' })
+	for _, expr := range ranges {
+		start, end, step, star, err := parseRange(expr, years)
+		if err != nil {
+			return nil, err
+		}
+		if star && step == 1 {
+			return nil, nil
+		}
+		for y := start; y <= end; y += step {
+			set[y] = true
+		}
 	}
 
-	return getBits(start, end, step) | extra, nil
+	list := make([]uint, 0, len(set))
+	for y := range set {
+		list = append(list, y)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i] < list[j] })
+	return list, nil
 }
 
 func parseIntOrName(expr string, names map[string]uint) (uint, error) {
@@ -41,6 +41,7 @@ type Finder struct {
 	isTail         bool
 	offset         int64
 	fileSize       int64
+	linePrefix     []byte
 }
 
 func NewFinder(filter func(os.FileInfo) bool) *Finder {
@@ -53,6 +54,18 @@ func (fd *Finder) SetTail(flag bool) {
 	fd.isTail = flag
 }
 
+// SetLinePrefix 只查找以prefix开头的行
+func (fd *Finder) SetLinePrefix(prefix string) {
+	fd.linePrefix = []byte(prefix)
+}
+
+func (fd *Finder) match(bts []byte) bool {
+	if len(fd.linePrefix) > 0 && !bytes.HasPrefix(bytes.TrimLeft(bts, "\n"), fd.linePrefix) {
+		return false
+	}
+	return fd.patternAll || fd.regexp.Match(bts)
+}
+
 func (fd *Finder) Offset() int64 {
 	return fd.offset
 }
@@ -119,7 +132,7 @@ func (fd *Finder) find(fpath string, modifyTime time.Time) error {
 			invert(bts)
 		}
 
-		if fd.patternAll || fd.regexp.Match(bts) {
+		if fd.match(bts) {
 			matchData = append(matchData, bts...)
 			fd.curr++
 		}
@@ -0,0 +1,97 @@
+package kproc
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/iwannay/log"
+)
+
+// cpuPeriod cpu.max的周期,单位微秒
+const cpuPeriod = 100000
+
+// createCgroup 在Cgroup目录下创建本次执行的子组并写入限制
+func (k *KCmd) createCgroup() (string, error) {
+	files := map[string]string{}
+	var controllers []string
+	if k.limits.Memory > 0 {
+		files["memory.max"] = strconv.FormatInt(k.limits.Memory, 10)
+		controllers = append(controllers, "+memory")
+	}
+	if k.limits.CPU > 0 {
+		files["cpu.max"] = fmt.Sprintf("%d %d", int64(k.limits.CPU*cpuPeriod), cpuPeriod)
+		controllers = append(controllers, "+cpu")
+	}
+	if k.limits.Pids > 0 {
+		files["pids.max"] = strconv.FormatInt(k.limits.Pids, 10)
+		controllers = append(controllers, "+pids")
+	}
+
+	if err := os.MkdirAll(k.limits.Cgroup, 0755); err != nil {
+		return "", err
+	}
+	// 父组需要开启子组用到的控制器
+	if err := ioutil.WriteFile(filepath.Join(k.limits.Cgroup, "cgroup.subtree_control"), []byte(strings.Join(controllers, " ")), 0644); err != nil {
+		return "", fmt.Errorf("enable controllers: %v", err)
+	}
+
+	dir, err := ioutil.TempDir(k.limits.Cgroup, "run-")
+	if err != nil {
+		return "", err
+	}
+	k.cgroup = dir
+	for name, value := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(value), 0644); err != nil {
+			k.releaseLimits()
+			return "", err
+		}
+	}
+	return dir, nil
+}
+
+// releaseLimits 进程退出后检查是否被OOM结束并删除cgroup
+func (k *KCmd) releaseLimits() {
+	if k.cgroup == "" {
+		return
+	}
+	dir := k.cgroup
+	k.cgroup = ""
+
+	if data, err := ioutil.ReadFile(filepath.Join(dir, "memory.events")); err == nil {
+		k.oomKilled = parseEvent(data, "oom_kill") > 0
+	}
+
+	// 结束组内残留的进程,cgroup.kill需要5.14以上的内核
+	if k.isKillChildProcess {
+		ioutil.WriteFile(filepath.Join(dir, "cgroup.kill"), []byte("1"), 0644)
+	}
+
+	var err error
+	for i := 0; i < 10; i++ {
+		if err = os.Remove(dir); err == nil || os.IsNotExist(err) {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	log.Error("remove cgroup error:", err)
+}
+
+// parseEvent 读取memory.events中的计数
+func parseEvent(data []byte, key string) int64 {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		fields := bytes.Fields(scanner.Bytes())
+		if len(fields) == 2 && string(fields[0]) == key {
+			n, _ := strconv.ParseInt(string(fields[1]), 10, 64)
+			return n
+		}
+	}
+	return 0
+}
@@ -0,0 +1,59 @@
+package kproc
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"jiacrontab/pkg/test"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestKCmd_Limits(t *testing.T) {
+	var out bytes.Buffer
+	cmd := CommandContext(context.Background(), "sh", "-c", "ulimit -n; grep 'Max processes' /proc/self/limits")
+	cmd.SetLimits(Limits{OpenFiles: 64, Processes: 1000})
+	cmd.Stdout = &out
+	test.Nil(t, cmd.Start())
+	test.Nil(t, cmd.Wait())
+	// 第二行由sh创建的子进程输出
+	test.Equal(t, []string{"64", "Max", "processes", "1000", "1000", "processes"}, strings.Fields(out.String()))
+}
+
+func TestKCmd_Cgroup(t *testing.T) {
+	// 用普通目录代替cgroup,检查命令执行前已加入子组
+	root := t.TempDir()
+	var out bytes.Buffer
+	cmd := CommandContext(context.Background(), "sh", "-c", "echo $$; cat "+root+"/run-*/cgroup.procs")
+	cmd.SetLimits(Limits{Cgroup: root, Memory: 64 << 20, Pids: 10})
+	cmd.Stdout = &out
+	test.Nil(t, cmd.Start())
+	cgroup := cmd.cgroup
+	test.Nil(t, cmd.Wait())
+
+	lines := strings.Fields(out.String())
+	test.Equal(t, 2, len(lines))
+	test.Equal(t, lines[0], lines[1])
+	test.Equal(t, strconv.Itoa(cmd.Process.Pid), lines[0])
+
+	b, err := ioutil.ReadFile(filepath.Join(root, "cgroup.subtree_control"))
+	test.Nil(t, err)
+	test.Equal(t, "+memory +pids", string(b))
+	b, err = ioutil.ReadFile(filepath.Join(cgroup, "memory.max"))
+	test.Nil(t, err)
+	test.Equal(t, "67108864", string(b))
+	_, err = os.Stat(filepath.Join(cgroup, "memory.swap.max"))
+	test.Equal(t, true, os.IsNotExist(err))
+}
+
+func TestKCmd_LimitsError(t *testing.T) {
+	// 超过fs.nr_open时root也无法设置,错误由重新执行的自身返回
+	cmd := CommandContext(context.Background(), "true")
+	cmd.SetLimits(Limits{OpenFiles: 1 << 40})
+	err := cmd.Start()
+	test.NotNil(t, err)
+	test.Equal(t, true, strings.HasPrefix(err.Error(), "setrlimit: "))
+}
@@ -0,0 +1,17 @@
+// +build !linux
+
+package kproc
+
+import "github.com/iwannay/log"
+
+func (k *KCmd) start() error {
+	if k.limits != (Limits{}) {
+		log.Warn("resource limits are only supported on linux")
+	}
+	if k.nice != 0 || k.ioClass != IOClassNone {
+		log.Warn("nice and io priority are only supported on linux")
+	}
+	return k.Cmd.Start()
+}
+
+func (k *KCmd) releaseLimits() {}
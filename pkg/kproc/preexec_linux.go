@@ -0,0 +1,181 @@
+package kproc
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// preExecEnv 需要设置资源限制或优先级时先带上该环境变量重新执行自身,
+// 由自身在exec命令前完成设置,命令及其子进程从启动起就受到限制
+const preExecEnv = "_JIACRONTAB_KPROC_PREEXEC"
+
+// preExec 重新执行的自身在exec命令前完成的设置
+type preExec struct {
+	Path         string
+	Fd           int // 设置失败时写入错误的管道,exec成功后关闭
+	AddressSpace int64
+	OpenFiles    int64
+	Processes    int64
+	Cgroup       string // 加入的cgroup目录
+	Nice         int
+	IOClass      int
+	IOLevel      int
+	Credential   *syscall.Credential
+}
+
+func init() {
+	v, ok := os.LookupEnv(preExecEnv)
+	if !ok {
+		return
+	}
+	// nice值和IO优先级按线程设置,需在同一线程exec
+	runtime.LockOSThread()
+	var p preExec
+	err := json.Unmarshal([]byte(v), &p)
+	if err == nil {
+		syscall.CloseOnExec(p.Fd)
+		err = p.exec()
+	}
+	if p.Fd > 0 {
+		os.NewFile(uintptr(p.Fd), "preexec").WriteString(err.Error())
+	}
+	os.Exit(127)
+}
+
+// exec 加入cgroup、设置rlimit和优先级并切换用户后exec命令,成功时不返回
+func (p *preExec) exec() error {
+	if p.Cgroup != "" {
+		if err := ioutil.WriteFile(filepath.Join(p.Cgroup, "cgroup.procs"), []byte(strconv.Itoa(os.Getpid())), 0644); err != nil {
+			return fmt.Errorf("join cgroup: %v", err)
+		}
+	}
+
+	for _, v := range []struct {
+		resource int
+		value    int64
+	}{
+		{unix.RLIMIT_AS, p.AddressSpace},
+		{unix.RLIMIT_NOFILE, p.OpenFiles},
+		{unix.RLIMIT_NPROC, p.Processes},
+	} {
+		if v.value <= 0 {
+			continue
+		}
+		if err := unix.Setrlimit(v.resource, &unix.Rlimit{Cur: uint64(v.value), Max: uint64(v.value)}); err != nil {
+			return fmt.Errorf("setrlimit: %v", err)
+		}
+	}
+
+	if err := setPriority(p.Nice, p.IOClass, p.IOLevel); err != nil {
+		return fmt.Errorf("set priority: %v", err)
+	}
+
+	// 以root完成上面的设置后再切换用户
+	if c := p.Credential; c != nil {
+		if !c.NoSetGroups {
+			groups := make([]int, len(c.Groups))
+			for i, v := range c.Groups {
+				groups[i] = int(v)
+			}
+			if err := syscall.Setgroups(groups); err != nil {
+				return fmt.Errorf("setgroups: %v", err)
+			}
+		}
+		if err := syscall.Setgid(int(c.Gid)); err != nil {
+			return fmt.Errorf("setgid: %v", err)
+		}
+		if err := syscall.Setuid(int(c.Uid)); err != nil {
+			return fmt.Errorf("setuid: %v", err)
+		}
+	}
+
+	var env []string
+	for _, v := range os.Environ() {
+		if !strings.HasPrefix(v, preExecEnv+"=") {
+			env = append(env, v)
+		}
+	}
+	return syscall.Exec(p.Path, os.Args, env)
+}
+
+// start 有资源限制或优先级设置时通过重新执行自身启动命令,
+// 启动失败或设置失败时返回错误
+func (k *KCmd) start() error {
+	p := preExec{
+		Path:         k.Cmd.Path,
+		AddressSpace: k.limits.AddressSpace,
+		OpenFiles:    k.limits.OpenFiles,
+		Processes:    k.limits.Processes,
+		Nice:         k.nice,
+		IOClass:      k.ioClass,
+		IOLevel:      k.ioLevel,
+	}
+	if p.AddressSpace <= 0 && p.OpenFiles <= 0 && p.Processes <= 0 && !k.limits.useCgroup() &&
+		p.Nice == 0 && p.IOClass == IOClassNone {
+		return k.Cmd.Start()
+	}
+	if k.Cmd.Err != nil {
+		return k.Cmd.Err
+	}
+
+	if k.limits.useCgroup() {
+		dir, err := k.createCgroup()
+		if err != nil {
+			return fmt.Errorf("create cgroup: %v", err)
+		}
+		p.Cgroup = dir
+	}
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		k.releaseLimits()
+		return err
+	}
+	defer r.Close()
+
+	// ExtraFiles中的第i个文件在子进程中为3+i
+	p.Fd = 3 + len(k.Cmd.ExtraFiles)
+	k.Cmd.ExtraFiles = append(k.Cmd.ExtraFiles, w)
+	if k.SysProcAttr != nil && k.SysProcAttr.Credential != nil {
+		p.Credential = k.SysProcAttr.Credential
+		k.SysProcAttr.Credential = nil
+	}
+	data, err := json.Marshal(p)
+	if err != nil {
+		w.Close()
+		k.releaseLimits()
+		return err
+	}
+	env := k.Cmd.Env
+	if env == nil {
+		env = os.Environ()
+	}
+	k.Cmd.Env = append(env[:len(env):len(env)], preExecEnv+"="+string(data))
+	// 子进程fork后exec前/proc/self/exe仍是当前程序,程序文件被替换时也能执行
+	k.Cmd.Path = "/proc/self/exe"
+
+	err = k.Cmd.Start()
+	w.Close()
+	if err != nil {
+		k.releaseLimits()
+		return err
+	}
+
+	msg, _ := ioutil.ReadAll(r)
+	if len(msg) > 0 {
+		k.Cmd.Wait()
+		k.releaseLimits()
+		return errors.New(string(msg))
+	}
+	return nil
+}
@@ -0,0 +1,22 @@
+package kproc
+
+import "syscall"
+
+// ioprioWhoProcess ioprio_set按线程设置
+const ioprioWhoProcess = 1
+
+// setPriority 设置当前线程的nice值和IO优先级,exec后由命令继承
+func setPriority(nice, ioClass, ioLevel int) error {
+	if nice != 0 {
+		if err := syscall.Setpriority(syscall.PRIO_PROCESS, 0, nice); err != nil {
+			return err
+		}
+	}
+	if ioClass != IOClassNone {
+		prio := ioClass<<13 | ioLevel
+		if _, _, errno := syscall.RawSyscall(syscall.SYS_IOPRIO_SET, ioprioWhoProcess, 0, uintptr(prio)); errno != 0 {
+			return errno
+		}
+	}
+	return nil
+}
@@ -0,0 +1,35 @@
+package kproc
+
+import (
+	"bytes"
+	"context"
+	"jiacrontab/pkg/test"
+	"os/exec"
+	"testing"
+)
+
+func TestKCmd_Nice(t *testing.T) {
+	var out bytes.Buffer
+	cmd := CommandContext(context.Background(), "sh", "-c", "cat /proc/self/stat")
+	cmd.SetNice(10)
+	cmd.SetIOPriority(IOClassIdle, 0)
+	cmd.Stdout = &out
+	test.Nil(t, cmd.Start())
+	test.Nil(t, cmd.Wait())
+	// /proc/[pid]/stat的第19列为nice值
+	fields := bytes.Fields(out.Bytes())
+	test.Equal(t, "10", string(fields[18]))
+}
+
+func TestKCmd_IOPriority(t *testing.T) {
+	if _, err := exec.LookPath("ionice"); err != nil {
+		t.Skip("ionice not found")
+	}
+	var out bytes.Buffer
+	cmd := CommandContext(context.Background(), "ionice")
+	cmd.SetIOPriority(IOClassBestEffort, 5)
+	cmd.Stdout = &out
+	test.Nil(t, cmd.Start())
+	test.Nil(t, cmd.Wait())
+	test.Equal(t, "best-effort: prio 5\n", out.String())
+}
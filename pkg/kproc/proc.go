@@ -2,15 +2,91 @@ package kproc
 
 import (
 	"context"
+	"fmt"
 	"jiacrontab/pkg/file"
+	"os"
 	"os/exec"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
 )
 
+// IO调度类型,与linux的ioprio class一致
+const (
+	IOClassNone = iota
+	// IOClassRealtime 实时,需要root权限
+	IOClassRealtime
+	// IOClassBestEffort 默认的尽力而为
+	IOClassBestEffort
+	// IOClassIdle 仅在磁盘空闲时执行IO
+	IOClassIdle
+)
+
+// 进程被停止时的结果
+const (
+	// StopGraceful 收到停止信号后在宽限时间内退出
+	StopGraceful = "graceful"
+	// StopForceKilled 未设置宽限时间或超过宽限时间后被SIGKILL
+	StopForceKilled = "forceKilled"
+)
+
+var signals = map[string]os.Signal{
+	"SIGHUP":  syscall.SIGHUP,
+	"SIGINT":  syscall.SIGINT,
+	"SIGQUIT": syscall.SIGQUIT,
+	"SIGKILL": syscall.SIGKILL,
+	"SIGTERM": syscall.SIGTERM,
+}
+
+// ParseSignal 解析信号名称,支持SIGTERM和TERM两种写法,为空时返回SIGTERM
+func ParseSignal(name string) (os.Signal, error) {
+	name = strings.ToUpper(strings.TrimSpace(name))
+	if name == "" {
+		return syscall.SIGTERM, nil
+	}
+	if !strings.HasPrefix(name, "SIG") {
+		name = "SIG" + name
+	}
+	if sig, ok := signals[name]; ok {
+		return sig, nil
+	}
+	return nil, fmt.Errorf("unsupported signal %s", name)
+}
+
 type KCmd struct {
 	ctx context.Context
 	*exec.Cmd
 	isKillChildProcess bool
 	done               chan struct{}
+	doneOnce           sync.Once
+	stopSignal         os.Signal
+	gracePeriod        time.Duration
+	stop               atomic.Value // 被停止时的结果
+	limits             Limits
+	nice               int
+	ioClass            int
+	ioLevel            int
+	cgroup             string // 本次执行的cgroup目录
+	oomKilled          bool
+}
+
+// Limits 进程的资源限制,为0的项不限制
+// 在exec命令前设置rlimit并加入cgroup,cgroup限制需要节点启用cgroup v2并将Cgroup目录委托给jiacrontabd
+type Limits struct {
+	AddressSpace int64   // RLIMIT_AS,单位字节
+	OpenFiles    int64   // RLIMIT_NOFILE
+	Processes    int64   // RLIMIT_NPROC,按执行用户计数
+	Cgroup       string  // cgroup v2父目录,每次执行在其下创建子组,为空时不使用cgroup
+	Memory       int64   // memory.max,单位字节
+	CPU          float64 // cpu.max,可使用的CPU核数
+	Pids         int64   // pids.max
+}
+
+// useCgroup 是否需要创建cgroup
+func (l Limits) useCgroup() bool {
+	return l.Cgroup != "" && (l.Memory > 0 || l.CPU > 0 || l.Pids > 0)
 }
 
 // SetEnv 设置环境变量
@@ -32,7 +108,85 @@ func (k *KCmd) SetDir(dir string) {
 	k.Cmd.Dir = dir
 }
 
+// SetStopSignal 设置ctx结束时发送给进程组的信号,默认为SIGTERM
+func (k *KCmd) SetStopSignal(sig os.Signal) {
+	k.stopSignal = sig
+}
+
+// SetGracePeriod 设置发送停止信号后等待进程退出的时间,超时后发送SIGKILL
+// 为0时直接发送SIGKILL,windows下忽略停止信号和宽限时间
+func (k *KCmd) SetGracePeriod(d time.Duration) {
+	k.gracePeriod = d
+}
+
+// SetLimits 设置资源限制,仅linux下生效
+func (k *KCmd) SetLimits(l Limits) {
+	k.limits = l
+}
+
+// SetNice 设置进程的nice值,子进程会继承,取值-20至19,仅linux下生效
+func (k *KCmd) SetNice(nice int) {
+	k.nice = nice
+}
+
+// SetIOPriority 设置进程的IO调度类型和优先级,子进程会继承,level取值0至7,越小优先级越高,仅linux下生效
+func (k *KCmd) SetIOPriority(class, level int) {
+	k.ioClass = class
+	k.ioLevel = level
+}
+
+// Start 启动进程,资源限制和优先级在exec前设置,设置失败时返回错误
+func (k *KCmd) Start() error {
+	return k.start()
+}
+
 // SetExitKillChildProcess 设置主进程退出时是否kill子进程,默认kill
 func (k *KCmd) SetExitKillChildProcess(ok bool) {
 	k.isKillChildProcess = ok
 }
+
+// Usage 进程退出后的退出码、终止信号和资源使用
+type Usage struct {
+	ExitCode  int           // 进程未启动或被信号终止时为-1
+	Signal    string        // 终止进程的信号
+	UserTime  time.Duration // 用户态CPU时间
+	SysTime   time.Duration // 内核态CPU时间
+	MaxRSS    int64         // 最大常驻内存,单位字节
+	Stop      string        // 被停止时的结果,StopGraceful或StopForceKilled
+	OOMKilled bool          // 超出cgroup内存限制被内核结束
+}
+
+// Add 合并管道中多个进程的资源使用,退出码和信号取第一个非正常退出的进程
+func (u *Usage) Add(o Usage) {
+	if u.ExitCode == 0 && u.Signal == "" {
+		u.ExitCode = o.ExitCode
+		u.Signal = o.Signal
+	}
+	if u.Stop == "" || o.Stop == StopForceKilled {
+		u.Stop = o.Stop
+	}
+	u.OOMKilled = u.OOMKilled || o.OOMKilled
+	u.UserTime += o.UserTime
+	u.SysTime += o.SysTime
+	if o.MaxRSS > u.MaxRSS {
+		u.MaxRSS = o.MaxRSS
+	}
+}
+
+// Usage 取得进程退出后的资源使用,需在Wait之后调用
+func (k *KCmd) Usage() Usage {
+	if k.ProcessState == nil {
+		return Usage{ExitCode: -1}
+	}
+	u := Usage{
+		ExitCode:  k.ProcessState.ExitCode(),
+		UserTime:  k.ProcessState.UserTime(),
+		SysTime:   k.ProcessState.SystemTime(),
+		OOMKilled: k.oomKilled,
+	}
+	if stop, ok := k.stop.Load().(string); ok {
+		u.Stop = stop
+	}
+	sysUsage(k.ProcessState, &u)
+	return u
+}
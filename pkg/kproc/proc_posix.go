@@ -7,14 +7,17 @@ import (
 	"os"
 	"os/exec"
 	"os/user"
+	"runtime"
 	"strconv"
 	"syscall"
+	"time"
 
 	"github.com/iwannay/log"
 )
 
 func CommandContext(ctx context.Context, name string, arg ...string) *KCmd {
-	cmd := exec.CommandContext(ctx, name, arg...)
+	// 由Wait监听ctx,先发送停止信号再在宽限时间后SIGKILL
+	cmd := exec.Command(name, arg...)
 	cmd.SysProcAttr = &syscall.SysProcAttr{}
 	cmd.SysProcAttr.Setsid = true
 	return &KCmd{
@@ -37,7 +40,7 @@ func (k *KCmd) SetUser(username string) {
 	}
 
 	log.Infof("KCmd set uid=%s,gid=%s", u.Uid, u.Gid)
-	k.SysProcAttr = &syscall.SysProcAttr{}
+	// 保留Setsid,停止时仍可向整个进程组发送信号
 	uid, _ := strconv.Atoi(u.Uid)
 	gid, _ := strconv.Atoi(u.Gid)
 	k.SysProcAttr.Credential = &syscall.Credential{Uid: uint32(uid), Gid: uint32(gid)}
@@ -45,12 +48,6 @@ func (k *KCmd) SetUser(username string) {
 }
 
 func (k *KCmd) KillAll() {
-
-	select {
-	case k.done <- struct{}{}:
-	default:
-	}
-
 	if k.Process == nil {
 		return
 	}
@@ -66,13 +63,64 @@ func (k *KCmd) KillAll() {
 }
 
 func (k *KCmd) Wait() error {
-	defer k.KillAll()
 	go func() {
 		select {
 		case <-k.ctx.Done():
-			k.KillAll()
+			k.terminate()
 		case <-k.done:
 		}
 	}()
-	return k.Cmd.Wait()
+	err := k.Cmd.Wait()
+	k.doneOnce.Do(func() { close(k.done) })
+	k.KillAll()
+	k.releaseLimits()
+	return err
+}
+
+// terminate 向进程组发送停止信号,宽限时间内未退出时SIGKILL
+func (k *KCmd) terminate() {
+	if k.Process == nil {
+		return
+	}
+	sig := k.stopSignal
+	if sig == nil {
+		sig = syscall.SIGTERM
+	}
+	if k.gracePeriod > 0 && sig != syscall.SIGKILL {
+		k.stop.Store(StopGraceful)
+		k.signal(sig)
+		t := time.NewTimer(k.gracePeriod)
+		defer t.Stop()
+		select {
+		case <-k.done:
+			return
+		case <-t.C:
+		}
+	}
+	k.stop.Store(StopForceKilled)
+	k.signal(syscall.SIGKILL)
+}
+
+// signal 设置了kill子进程时发送给整个进程组
+func (k *KCmd) signal(sig os.Signal) {
+	if !k.isKillChildProcess {
+		k.Process.Signal(sig)
+		return
+	}
+	if group, err := os.FindProcess(-k.Process.Pid); err == nil {
+		group.Signal(sig)
+	}
+}
+
+func sysUsage(state *os.ProcessState, u *Usage) {
+	if ws, ok := state.Sys().(syscall.WaitStatus); ok && ws.Signaled() {
+		u.Signal = ws.Signal().String()
+	}
+	if ru, ok := state.SysUsage().(*syscall.Rusage); ok {
+		u.MaxRSS = int64(ru.Maxrss)
+		// darwin下Maxrss的单位为字节,其余平台为KB
+		if runtime.GOOS != "darwin" {
+			u.MaxRSS *= 1024
+		}
+	}
 }
@@ -0,0 +1,46 @@
+// +build !windows
+
+package kproc
+
+import (
+	"context"
+	"jiacrontab/pkg/test"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestKCmd_Terminate(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cmd := CommandContext(ctx, "sh", "-c", `trap "exit 0" TERM; sleep 10 & wait`)
+	cmd.SetGracePeriod(5 * time.Second)
+	test.Nil(t, cmd.Start())
+	time.AfterFunc(200*time.Millisecond, cancel)
+	test.Nil(t, cmd.Wait())
+	test.Equal(t, StopGraceful, cmd.Usage().Stop)
+
+	// 忽略停止信号时超过宽限时间后被SIGKILL
+	ctx, cancel = context.WithCancel(context.Background())
+	cmd = CommandContext(ctx, "sh", "-c", `trap "" TERM; sleep 10`)
+	cmd.SetGracePeriod(200 * time.Millisecond)
+	test.Nil(t, cmd.Start())
+	time.AfterFunc(200*time.Millisecond, cancel)
+	test.NotNil(t, cmd.Wait())
+	u := cmd.Usage()
+	test.Equal(t, StopForceKilled, u.Stop)
+	test.Equal(t, -1, u.ExitCode)
+	test.Equal(t, syscall.SIGKILL.String(), u.Signal)
+}
+
+func TestParseSignal(t *testing.T) {
+	sig, err := ParseSignal("")
+	test.Nil(t, err)
+	test.Equal(t, syscall.SIGTERM, sig)
+
+	sig, err = ParseSignal("int")
+	test.Nil(t, err)
+	test.Equal(t, syscall.SIGINT, sig)
+
+	_, err = ParseSignal("SIGFOO")
+	test.NotNil(t, err)
+}
@@ -0,0 +1,26 @@
+package kproc
+
+import (
+	"context"
+	"jiacrontab/pkg/test"
+	"testing"
+	"time"
+)
+
+func TestUsage_Add(t *testing.T) {
+	u := Usage{UserTime: time.Second, MaxRSS: 1 << 20}
+	u.Add(Usage{ExitCode: 2, UserTime: time.Second, SysTime: time.Second, MaxRSS: 2 << 20})
+	u.Add(Usage{ExitCode: -1, Signal: "killed"})
+
+	test.Equal(t, 2, u.ExitCode)
+	test.Equal(t, "", u.Signal)
+	test.Equal(t, 2*time.Second, u.UserTime)
+	test.Equal(t, time.Second, u.SysTime)
+	test.Equal(t, int64(2<<20), u.MaxRSS)
+}
+
+func TestKCmd_UsageNotStarted(t *testing.T) {
+	cmd := CommandContext(context.Background(), "not-exist-command")
+	test.NotNil(t, cmd.Start())
+	test.Equal(t, -1, cmd.Usage().ExitCode)
+}
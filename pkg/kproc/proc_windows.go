@@ -3,6 +3,7 @@ package kproc
 import (
 	"context"
 	"fmt"
+	"os"
 	"os/exec"
 )
 
@@ -47,5 +48,9 @@ func (k *KCmd) Wait() error {
 		case <-k.done:
 		}
 	}()
+	defer k.releaseLimits()
 	return k.Cmd.Wait()
 }
+
+// sysUsage windows下没有终止信号和最大常驻内存
+func sysUsage(state *os.ProcessState, u *Usage) {}
@@ -53,10 +53,35 @@ func (pq *PriorityQueue) Push(x interface{}) {
 	(*pq)[n] = item
 }
 
-func (pq *PriorityQueue) update(item *Item, value string, priority int64) {
-	item.Value = value
+// Update 原地修改item的优先级并调整其在堆中的位置
+func (pq *PriorityQueue) Update(item *Item, priority int64) bool {
+	if !pq.contains(item) {
+		return false
+	}
 	item.Priority = priority
 	heap.Fix(pq, item.Index)
+	return true
+}
+
+// Remove 根据item.Index从堆中删除item
+func (pq *PriorityQueue) Remove(item *Item) bool {
+	if !pq.contains(item) {
+		return false
+	}
+	heap.Remove(pq, item.Index)
+	return true
+}
+
+// Peek 返回优先级最高的原素,队列为空时返回nil
+func (pq PriorityQueue) Peek() *Item {
+	if len(pq) == 0 {
+		return nil
+	}
+	return pq[0]
+}
+
+func (pq PriorityQueue) contains(item *Item) bool {
+	return item != nil && item.Index >= 0 && item.Index < len(pq) && pq[item.Index] == item
 }
 
 // Pop 弹出队列末端原素
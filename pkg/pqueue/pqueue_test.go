@@ -2,6 +2,7 @@ package pqueue
 
 import (
 	"container/heap"
+	"math"
 	"math/rand"
 	"path/filepath"
 	"reflect"
@@ -77,3 +78,63 @@ func TestRemove(t *testing.T) {
 		lastPriority = item.(*Item).Priority
 	}
 }
+
+func TestUpdate(t *testing.T) {
+	c := 100
+	pq := New(c)
+	items := make([]*Item, 0, c)
+
+	for i := 0; i < c; i++ {
+		item := &Item{Value: i, Priority: int64(i)}
+		items = append(items, item)
+		heap.Push(&pq, item)
+	}
+
+	equal(t, pq.Update(items[50], -1), true)
+	equal(t, pq.Peek(), items[50])
+
+	equal(t, pq.Remove(items[50]), true)
+	equal(t, pq.Remove(items[50]), false)
+	equal(t, pq.Update(items[50], 0), false)
+	equal(t, pq.Len(), c-1)
+	equal(t, pq.Peek(), items[0])
+}
+
+func benchmarkItems(n int) (PriorityQueue, []*Item) {
+	pq := New(n)
+	items := make([]*Item, 0, n)
+	for i := 0; i < n; i++ {
+		item := &Item{Value: i, Priority: rand.Int63()}
+		items = append(items, item)
+		heap.Push(&pq, item)
+	}
+	return pq, items
+}
+
+// BenchmarkRescheduleUpdate 通过Index原地调整任务的执行时间
+func BenchmarkRescheduleUpdate(b *testing.B) {
+	pq, items := benchmarkItems(10000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		pq.Update(items[i%len(items)], rand.Int63())
+	}
+	b.ReportMetric(float64(pq.Len()), "items")
+}
+
+// BenchmarkRescheduleDuplicatePush 重新调度时直接追加新的任务,旧任务留在堆中
+func BenchmarkRescheduleDuplicatePush(b *testing.B) {
+	pq, items := benchmarkItems(10000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		heap.Push(&pq, &Item{Value: items[i%len(items)].Value, Priority: rand.Int63()})
+	}
+	b.ReportMetric(float64(pq.Len()), "items")
+}
+
+func BenchmarkPeekAndShift(b *testing.B) {
+	pq, _ := benchmarkItems(b.N)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		pq.PeekAndShift(math.MaxInt64)
+	}
+}
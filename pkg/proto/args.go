@@ -14,6 +14,7 @@ type SearchLog struct {
 	Pagesize int
 	Date     string
 	Pattern  string
+	Stream   string // 只查找该输出流的日志,为空时不限制
 }
 
 type CleanNodeLog struct {
@@ -64,3 +65,11 @@ type GetJobArgs struct {
 type EmptyArgs struct{}
 
 type EmptyReply struct{}
+
+// LockArgs 集群锁的取得和释放,Holder为空时释放节点持有的全部锁
+type LockArgs struct {
+	Addr   string
+	Holder string
+	Names  []string
+	Lease  int // 租约秒数
+}
@@ -68,3 +68,94 @@ type EditCrontabJobArgs struct {
 	GroupID uint
 	Root    bool
 }
+
+type SchedulePreviewArgs struct {
+	JobID     uint
+	CronExpr  string
+	TimeArgs  models.TimeArgs
+	Calendars []uint
+	// CalendarRules admin下发的排除日历
+	CalendarRules []models.Calendar
+	// ActiveFrom、ActiveUntil 有效期,为零值时不限制
+	ActiveFrom  time.Time
+	ActiveUntil time.Time
+	// ScheduleType 调度方式,Interval 固定间隔秒数
+	ScheduleType string
+	Interval     int
+	Num          int
+}
+
+// ScheduleFieldError 定时规则的字段错误,Index、Offset为字段在cron表达式中的位置
+type ScheduleFieldError struct {
+	Field   string `json:"field"`
+	Value   string `json:"value"`
+	Index   int    `json:"index"`
+	Offset  int    `json:"offset"`
+	Message string `json:"message"`
+}
+
+type SchedulePreviewReply struct {
+	Times       []time.Time          `json:"times"`
+	Description string               `json:"description"`
+	Errors      []ScheduleFieldError `json:"errors"`
+	// Skipped 预览范围内因排除日历跳过的执行
+	Skipped []models.SkippedExecution `json:"skipped"`
+}
+
+// job动态类型
+const (
+	// JobEvent_Expired job超出有效期
+	JobEvent_Expired = "expired"
+)
+
+type JobEventArgs struct {
+	Addr    string
+	GroupID uint
+	JobID   uint
+	JobName string
+	Event   string
+}
+
+type GetCalendarsArgs struct {
+	IDs []uint
+}
+
+// RunOnceArgs 在指定时刻执行一次job
+// RunAt为零值时在Delay之后执行,Command等参数不为空时覆盖job的配置
+type RunOnceArgs struct {
+	UserID   uint
+	Username string
+	GroupID  uint
+	Root     bool
+	JobID    uint
+	RunAt    time.Time
+	Delay    time.Duration
+	Command  []string
+	Code     string
+	WorkEnv  []string
+	WorkDir  string
+	Timeout  int
+}
+
+type QueryOneOffArgs struct {
+	UserID         uint
+	GroupID        uint
+	Root           bool
+	JobID          uint
+	Status         string
+	Page, Pagesize int
+}
+
+type QueryOneOffRet struct {
+	Total    int64
+	Page     int
+	Pagesize int
+	List     []models.OneOffRun
+}
+
+type CancelOneOffArgs struct {
+	UserID  uint
+	GroupID uint
+	Root    bool
+	IDs     []uint
+}